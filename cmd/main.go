@@ -2,17 +2,73 @@
 // * Author       :loyd
 // * Date         :2024-11-10 21:26:54
 // * LastEditors  :loyd
-// * LastEditTime :2024-11-10 21:26:56
+// * LastEditTime :2025-03-12 22:45:10
 // * Description  :
 // *
 // *
 
 package main
 
-import "zol9527/proxies/internal"
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"zol9527/proxies/internal"
+)
+
+// overrideFlags 收集可重复出现的 --set 参数
+type overrideFlags []string
+
+func (o *overrideFlags) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *overrideFlags) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
 
 func main() {
+	var configPath string
+	var overrides overrideFlags
+	var daemon bool
+	var checkWorkers, probeTimeout, checkBudget int
+
+	flag.StringVar(&configPath, "config", "", "配置文件路径 (优先于环境变量 PROXIES_CONFIG)")
+	flag.Var(&overrides, "set", "覆盖配置项, 格式为 section.key=value, 可重复使用")
+	flag.BoolVar(&daemon, "daemon", false, "以长驻模式运行, 按 pool.interval 周期爬取并热加载配置")
+	flag.IntVar(&checkWorkers, "check-workers", 0, "同时检查的代理数量, 等同于 --set check.workers")
+	flag.IntVar(&probeTimeout, "probe-timeout", 0, "单个检查项的超时(毫秒), 等同于 --set check.probeTimeout")
+	flag.IntVar(&checkBudget, "check-budget", 0, "单个代理全部检查项的总时限(毫秒), 等同于 --set check.budget")
+	flag.Parse()
+
+	// 显式设置的检查参数转换为覆盖项, 排在 --set 之后以优先生效
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "check-workers":
+			overrides = append(overrides, fmt.Sprintf("check.workers=%d", checkWorkers))
+		case "probe-timeout":
+			overrides = append(overrides, fmt.Sprintf("check.probeTimeout=%d", probeTimeout))
+		case "check-budget":
+			overrides = append(overrides, fmt.Sprintf("check.budget=%d", checkBudget))
+		}
+	})
+
+	// 第一次 Ctrl-C 或 SIGTERM 停止接收新的代理并写入部分结果, 之后恢复默认处理, 再次 Ctrl-C 立即退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	if daemon {
+		internal.RunDaemon(ctx, configPath, overrides)
+		return
+	}
 
 	// start schedule
-	internal.Scrape()
+	config := internal.LoadConfiguration(configPath, overrides)
+	internal.Scrape(ctx, config)
 }
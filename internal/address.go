@@ -0,0 +1,202 @@
+// Author       :loyd
+// Date         :2025-04-01 20:08:44
+// LastEditors  :loyd
+// LastEditTime :2025-04-01 22:51:30
+// Description  :代理地址(IPv4/IPv6/主机名)的拆分与规范化
+
+package internal
+
+import (
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// hostnamePattern 匹配至少两级的域名, 每级由字母数字和连字符组成
+	hostnamePattern = regexp.MustCompile(`^(?i)[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?(?:\.[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?)+$`)
+	// dottedQuadPattern 匹配点分十进制形式的IPv4, 各段允许带前导零
+	dottedQuadPattern = regexp.MustCompile(`^\d{1,3}(?:\.\d{1,3}){3}$`)
+)
+
+// bogonPrefixes 不会出现在公网上的保留地址段, 私有、回环、链路本地和组播地址由 netip 直接判断
+var bogonPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // 本网络
+	netip.MustParsePrefix("100.64.0.0/10"),   // 运营商级 NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF 协议分配
+	netip.MustParsePrefix("192.0.2.0/24"),    // TEST-NET-1
+	netip.MustParsePrefix("198.18.0.0/15"),   // 基准测试
+	netip.MustParsePrefix("198.51.100.0/24"), // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // TEST-NET-3
+	netip.MustParsePrefix("240.0.0.0/4"),     // 保留及广播地址
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // 本地 NAT64
+	netip.MustParsePrefix("100::/64"),        // 丢弃前缀
+	netip.MustParsePrefix("2001:db8::/32"),   // 文档示例
+	netip.MustParsePrefix("3fff::/20"),       // 文档示例
+}
+
+// reservedDomainSuffixes 不会解析到公网地址的保留域名后缀
+var reservedDomainSuffixes = []string{".localhost", ".local", ".internal", ".invalid", ".test", ".example", ".lan", ".home.arpa"}
+
+// splitAddress ✂️ 拆分 "ip:port"、"[v6]:port" 或 "host:port" 形式的地址
+//
+// 参数:
+//   - address: 待拆分的地址
+//
+// 返回值:
+//   - string: 主机部分(IPv6 不含方括号)
+//   - string: 端口部分
+//   - bool: 是否为带端口的地址
+func splitAddress(address string) (string, string, bool) {
+	host, port, err := net.SplitHostPort(strings.TrimSpace(address))
+	if err != nil || host == "" || port == "" {
+		return "", "", false
+	}
+	return host, port, true
+}
+
+// normalizeAddress 🧽 校验并规范化代理地址
+//
+// IPv4 与 IPv6 统一为标准文本形式(IPv4 映射的 IPv6 地址还原为 IPv4),
+// 主机名转为小写并去掉末尾的点, 最终以 net.JoinHostPort 拼接,
+// 因此 IPv6 地址的格式为 "[v6]:port"
+//
+// 参数:
+//   - host: 主机部分, IPv6 可以带或不带方括号
+//   - port: 端口部分
+//
+// 返回值:
+//   - string: 规范化后的地址
+//   - bool: 地址是否有效
+func normalizeAddress(host, port string) (string, bool) {
+	host = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(host), "["), "]")
+
+	portNum, err := strconv.Atoi(strings.TrimSpace(port))
+	if err != nil || portNum <= 0 || portNum > 65535 {
+		return "", false
+	}
+
+	if dottedQuadPattern.MatchString(host) {
+		host = stripLeadingZeros(host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if addr.Zone() != "" {
+			return "", false
+		}
+		return net.JoinHostPort(addr.Unmap().String(), strconv.Itoa(portNum)), true
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !isHostname(host) {
+		return "", false
+	}
+	return net.JoinHostPort(host, strconv.Itoa(portNum)), true
+}
+
+// stripLeadingZeros 去掉点分十进制各段的前导零, 如 "010.001.002.003" 转为 "10.1.2.3"
+func stripLeadingZeros(host string) string {
+	octets := strings.Split(host, ".")
+	for i, octet := range octets {
+		if trimmed := strings.TrimLeft(octet, "0"); trimmed != "" {
+			octets[i] = trimmed
+		} else {
+			octets[i] = "0"
+		}
+	}
+	return strings.Join(octets, ".")
+}
+
+// isHostname 判断是否为合法域名, 顶级域不能全为数字以免把残缺的IP当作域名
+func isHostname(host string) bool {
+	if len(host) > 253 || !hostnamePattern.MatchString(host) {
+		return false
+	}
+	tld := host[strings.LastIndex(host, ".")+1:]
+	return strings.Trim(tld, "0123456789") != ""
+}
+
+// isHostnameAddress 判断规范化后的地址是否使用主机名
+func isHostnameAddress(address string) bool {
+	host, _, ok := splitAddress(address)
+	if !ok {
+		return false
+	}
+	_, err := netip.ParseAddr(host)
+	return err != nil
+}
+
+// isPublicAddress 🌍 判断规范化后的地址是否可能是公网代理
+//
+// IP 地址排除私有、回环、链路本地、组播、未指定地址及 bogonPrefixes 中的保留段,
+// 域名地址排除保留后缀, 其余域名在解析前无法判断, 由解析阶段 resolveCandidates 按解析结果判断
+//
+// 参数:
+//   - address: 规范化后的地址
+//
+// 返回值:
+//   - bool: 是否为公网地址
+func isPublicAddress(address string) bool {
+	host, _, ok := splitAddress(address)
+	if !ok {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		for _, suffix := range reservedDomainSuffixes {
+			if strings.HasSuffix("."+host, suffix) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return isPublicAddr(addr)
+}
+
+// isPublicAddr 判断IP是否不属于私有、回环、链路本地、组播、未指定地址及 bogonPrefixes 中的保留段
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range bogonPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// 候选代理地址被丢弃的原因
+const (
+	addressInvalid  = "invalid"
+	addressReserved = "reserved"
+)
+
+// sanitizeCandidate 🧼 规范化候选代理地址, 格式无效或属于保留地址段的候选会被丢弃
+//
+// 参数:
+//   - candidate: 待检查的候选代理
+//
+// 返回值:
+//   - Candidate: 地址已规范化的候选代理
+//   - string: 丢弃原因 invalid 或 reserved, 可以使用时为空
+func sanitizeCandidate(candidate Candidate) (Candidate, string) {
+	host, port, ok := splitAddress(candidate.Address)
+	if !ok {
+		return candidate, addressInvalid
+	}
+	address, ok := normalizeAddress(host, port)
+	if !ok {
+		return candidate, addressInvalid
+	}
+	if !isPublicAddress(address) {
+		return candidate, addressReserved
+	}
+	candidate.Address = address
+	return candidate, ""
+}
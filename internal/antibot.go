@@ -0,0 +1,176 @@
+// Author       :loyd
+// Date         :2025-04-08 20:21:44
+// LastEditors  :loyd
+// LastEditTime :2025-04-08 23:12:09
+// Description  :识别代理源返回的反爬拦截页面, 并通过已验证的代理重试
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"zol9527/proxies/pkg/logger"
+
+	"github.com/duke-git/lancet/v2/fileutil"
+	"github.com/duke-git/lancet/v2/strutil"
+)
+
+// relayAttempts 来源被拦截后最多尝试的中转代理数量
+const relayAttempts = 3
+
+var (
+	// challengeMarkers 人机校验页面特有的脚本路径、参数与 Cookie 名称, 命中即视为被拦截;
+	// 防护厂商名称可能作为 ISP/组织列出现在正常的代理列表中, 不能放在这里
+	challengeMarkers = []string{
+		"cf-chl",
+		"cf_chl_opt",
+		"/cdn-cgi/challenge-platform",
+		"challenges.cloudflare.com/turnstile",
+		"<title>just a moment...</title>",
+		"attention required! | cloudflare",
+		"checking your browser before accessing",
+		"/.well-known/ddos-guard/",
+		"__ddg1_",
+		"_incapsula_resource",
+		"sucuri_cloudproxy_js",
+		"captcha-delivery.com",
+		"px-captcha",
+	}
+	// captchaMarkers 验证码脚本与拒绝访问提示, 正常页面也可能出现,
+	// 因此只在非 2xx 响应或未解析到代理时视为被拦截
+	captchaMarkers = []string{
+		"google.com/recaptcha",
+		"g-recaptcha",
+		"hcaptcha.com",
+		"h-captcha",
+		"geetest",
+		"captcha",
+		"<title>access denied",
+		"<h1>access denied",
+		"access to this page has been denied",
+		"you have been blocked",
+		"sucuri website firewall",
+		"访问被拒绝",
+		"验证码",
+	}
+	// protectionServers 反爬防护服务在响应头 Server 中的标识
+	protectionServers = []string{"cloudflare", "ddos-guard", "akamaighost", "sucuri", "incapsula", "qrator"}
+)
+
+// detectBlocked 🧱 判断响应是否为反爬拦截页面
+//
+// 参数:
+//   - status: HTTP 状态码
+//   - header: 响应头
+//   - body: 响应内容
+//   - strictOnly: 为 true 时只使用不会误判的强特征, 用于解析前的 2xx 响应
+//
+// 返回值:
+//   - *fetchError: 被拦截时返回 blocked 错误, 否则为 nil
+func detectBlocked(status int, header http.Header, body string, strictOnly bool) *fetchError {
+	blocked := func(reason string) *fetchError {
+		return &fetchError{Category: errorBlocked, Status: status, Err: fmt.Errorf("blocked by anti-bot page (%s)", reason)}
+	}
+
+	if mitigated := header.Get("Cf-Mitigated"); mitigated != "" {
+		return blocked("cf-mitigated: " + mitigated)
+	}
+
+	lower := strings.ToLower(body)
+	for _, marker := range challengeMarkers {
+		if strings.Contains(lower, marker) {
+			return blocked(marker)
+		}
+	}
+	if strictOnly {
+		return nil
+	}
+
+	for _, marker := range captchaMarkers {
+		if strings.Contains(lower, marker) {
+			return blocked(marker)
+		}
+	}
+	if status == http.StatusForbidden {
+		server := strings.ToLower(header.Get("Server"))
+		for _, name := range protectionServers {
+			if strings.Contains(server, name) {
+				return blocked("403 from " + name)
+			}
+		}
+	}
+	return nil
+}
+
+// isBlocked 判断错误是否为被拦截
+func isBlocked(err error) bool {
+	return err != nil && classifyFetchError(err).Category == errorBlocked
+}
+
+// relayProxy 可用于中转请求的已验证代理
+type relayProxy struct {
+	url   *url.URL
+	http  bool
+	https bool
+}
+
+// loadRelayProxies 📋 从历史结果文件中读取支持 HTTP/HTTPS 的已验证代理, 作为被拦截来源的中转
+//
+// 返回值:
+//   - []relayProxy: 可用的中转代理, 没有历史文件时为空
+func loadRelayProxies() []relayProxy {
+	filePath := findHistoryFile()
+	if filePath == "" {
+		return nil
+	}
+	content, err := fileutil.ReadFileToString(filePath)
+	if err != nil {
+		return nil
+	}
+
+	var relays []relayProxy
+	for _, line := range strutil.SplitAndTrim(content, "\n") {
+		var record ProxyRecord
+		// 需要认证的代理在输出中没有认证信息, 无法用作中转
+		if err := json.Unmarshal([]byte(line), &record); err != nil || (!record.Http && !record.Https) || record.Auth {
+			continue
+		}
+		proxyURL, err := url.Parse("http://" + record.IP)
+		if err != nil {
+			continue
+		}
+		relays = append(relays, relayProxy{url: proxyURL, http: record.Http, https: record.Https})
+	}
+
+	logger.GetLogger().Debug(fmt.Sprintf("🔀 加载到 %d 个可用于中转的代理", len(relays)))
+	return relays
+}
+
+// pickRelays 🎲 随机挑选支持目标协议的中转代理
+//
+// 参数:
+//   - relays: 全部中转代理
+//   - rawURL: 请求地址, https 地址需要支持 CONNECT 的代理
+//   - limit: 最多挑选的数量
+//
+// 返回值:
+//   - []*url.URL: 挑选出的代理地址
+func pickRelays(relays []relayProxy, rawURL string, limit int) []*url.URL {
+	secure := strings.HasPrefix(strings.ToLower(rawURL), "https://")
+
+	var matched []*url.URL
+	for _, relay := range relays {
+		if (secure && relay.https) || (!secure && relay.http) {
+			matched = append(matched, relay.url)
+		}
+	}
+	rand.Shuffle(len(matched), func(i, j int) { matched[i], matched[j] = matched[j], matched[i] })
+	if len(matched) > limit {
+		matched = matched[:limit]
+	}
+	return matched
+}
@@ -0,0 +1,198 @@
+// Author       :loyd
+// Date         :2025-04-09 20:07:15
+// LastEditors  :loyd
+// LastEditTime :2025-04-09 22:31:48
+// Description  :代理源响应缓存, 未变化的来源通过条件请求复用上次解析的结果
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"zol9527/proxies/pkg/logger"
+	"zol9527/proxies/pkg/resource"
+
+	"github.com/duke-git/lancet/v2/convertor"
+	"github.com/duke-git/lancet/v2/cryptor"
+	"github.com/duke-git/lancet/v2/fileutil"
+)
+
+// defaultCacheMaxAge 未配置 cache.maxAge 时缓存的最长有效期
+const defaultCacheMaxAge = 24 * time.Hour
+
+// cacheEntry 单个URL的缓存
+type cacheEntry struct {
+	// ETag 响应头 ETag, 用于 If-None-Match
+	ETag string `json:"etag,omitempty"`
+	// LastModified 响应头 Last-Modified, 用于 If-Modified-Since
+	LastModified string `json:"lastModified,omitempty"`
+	// Fingerprint 平台配置的摘要, 提取规则变化后缓存失效
+	Fingerprint string `json:"fingerprint"`
+	// FetchedAt 最近一次完整下载的时间, 304 不会刷新
+	FetchedAt time.Time `json:"fetchedAt"`
+	// Candidates 上次解析到的候选代理
+	Candidates []Candidate `json:"candidates"`
+}
+
+// sourceCache 代理源响应缓存, 可被多个抓取协程并发读写
+type sourceCache struct {
+	path   string
+	maxAge time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry
+	dirty   bool
+}
+
+// loadSourceCache 📦 读取缓存文件, 未配置 cache.path 时返回 nil
+//
+// 参数:
+//   - config: 缓存配置
+//
+// 返回值:
+//   - *sourceCache: 缓存, 文件不存在或损坏时从空缓存开始
+func loadSourceCache(config resource.CacheConfig) *sourceCache {
+	if config.Path == "" {
+		return nil
+	}
+
+	cache := &sourceCache{
+		path:    config.Path,
+		maxAge:  time.Duration(config.MaxAge) * time.Second,
+		entries: make(map[string]*cacheEntry),
+	}
+	if cache.maxAge <= 0 {
+		cache.maxAge = defaultCacheMaxAge
+	}
+
+	if fileutil.IsExist(config.Path) {
+		data, err := os.ReadFile(config.Path)
+		if err == nil {
+			err = json.Unmarshal(data, &cache.entries)
+		}
+		if err != nil {
+			logger.GetLogger().Warn(fmt.Sprintf("⚠️ 读取来源缓存失败, 重新开始缓存 [%s]: %v", config.Path, err))
+			cache.entries = make(map[string]*cacheEntry)
+		}
+	}
+	return cache
+}
+
+// lookup 🔎 返回URL仍然有效的缓存
+//
+// 参数:
+//   - platform: URL所属的平台配置
+//   - rawURL: 请求地址
+//
+// 返回值:
+//   - *cacheEntry: 缓存, 不存在、已过期或平台配置已变化时为 nil
+func (c *sourceCache) lookup(platform resource.PlatformConfig, rawURL string) *cacheEntry {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[rawURL]
+	if !ok || entry.Fingerprint != platformFingerprint(platform) || time.Since(entry.FetchedAt) > c.maxAge {
+		return nil
+	}
+	return entry
+}
+
+// store 💾 记录一次完整下载的结果, 响应没有 ETag 和 Last-Modified 时无法发送条件请求, 不缓存
+//
+// 参数:
+//   - platform: URL所属的平台配置
+//   - rawURL: 请求地址
+//   - header: 响应头
+//   - candidates: 解析到的候选代理
+func (c *sourceCache) store(platform resource.PlatformConfig, rawURL string, header http.Header, candidates []Candidate) {
+	if c == nil {
+		return
+	}
+
+	entry := &cacheEntry{
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Fingerprint:  platformFingerprint(platform),
+		FetchedAt:    time.Now(),
+		Candidates:   candidates,
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if entry.ETag == "" && entry.LastModified == "" {
+		if _, ok := c.entries[rawURL]; ok {
+			delete(c.entries, rawURL)
+			c.dirty = true
+		}
+		return
+	}
+	c.entries[rawURL] = entry
+	c.dirty = true
+}
+
+// save 💾 清理过期条目后写回缓存文件
+func (c *sourceCache) save() {
+	if c == nil {
+		return
+	}
+	logger := logger.GetLogger()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for rawURL, entry := range c.entries {
+		if time.Since(entry.FetchedAt) > c.maxAge {
+			delete(c.entries, rawURL)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("⚠️ 生成来源缓存失败: %v", err))
+		return
+	}
+	// 先写临时文件再替换, 避免中断时留下损坏的缓存
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		logger.Warn(fmt.Sprintf("⚠️ 写入来源缓存失败 [%s]: %v", c.path, err))
+		return
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		logger.Warn(fmt.Sprintf("⚠️ 写入来源缓存失败 [%s]: %v", c.path, err))
+		return
+	}
+	c.dirty = false
+	logger.Debug(fmt.Sprintf("💾 来源缓存已写入 %s (%d 个URL)", c.path, len(c.entries)))
+}
+
+// setConditionalHeaders 为请求添加 If-None-Match 与 If-Modified-Since
+func (e *cacheEntry) setConditionalHeaders(headers http.Header) {
+	if e == nil {
+		return
+	}
+	if e.ETag != "" {
+		headers.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		headers.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+// platformFingerprint 计算平台配置的摘要
+func platformFingerprint(platform resource.PlatformConfig) string {
+	jsonStr, err := convertor.ToJson(platform)
+	if err != nil {
+		return ""
+	}
+	return cryptor.Sha1(jsonStr)
+}
@@ -0,0 +1,278 @@
+// Author       :loyd
+// Date         :2025-03-22 19:26:30
+// LastEditors  :loyd
+// LastEditTime :2025-03-22 23:10:44
+// Description  :候选代理与验证结果的数据结构
+
+package internal
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"zol9527/proxies/pkg/check"
+	"zol9527/proxies/pkg/geo"
+	"zol9527/proxies/pkg/logger"
+	"zol9527/proxies/pkg/resource"
+)
+
+// Candidate 从代理源提取到的待验证代理, 附带来源声明的提示信息
+type Candidate struct {
+	// Address 代理地址, 格式为 "IP:PORT"、"[IPv6]:PORT" 或 "域名:PORT"
+	Address string
+	// Username 代理认证用户名, 为空表示无需认证
+	Username string
+	// Password 代理认证密码
+	Password string
+	// Source 提供该代理的平台名称
+	Source string
+	// Hints 来源声明的协议、国家和匿名度
+	Hints Claims
+	// Resolved 域名代理在解析阶段得到的全部IP, IP 地址的候选代理为空
+	Resolved []netip.Addr
+}
+
+// Claims 来源声明(未经验证)的代理属性
+type Claims struct {
+	Protocol  string `json:"protocol,omitempty"`
+	Country   string `json:"country,omitempty"`
+	Anonymity string `json:"anonymity,omitempty"`
+}
+
+// ProxyRecord 验证通过的代理记录, 即输出文件中的一行
+type ProxyRecord struct {
+	IP        string  `json:"ip"`
+	Resolved  string  `json:"resolved,omitempty"`
+	Http      bool    `json:"http"`
+	Https     bool    `json:"https"`
+	Socks5    bool    `json:"socks5"`
+	Anonymity string  `json:"anonymity"`
+	ExitIP    string  `json:"exitIp,omitempty"`
+	Source    string  `json:"source,omitempty"`
+	Claimed   *Claims `json:"claimed,omitempty"`
+	// Auth 代理需要认证, 认证信息只在检查时使用, 不写入输出文件
+	Auth bool `json:"auth,omitempty"`
+
+	// Geo 监听IP(域名代理为解析到的IP)的地理位置与 ASN, 未配置 [geo] 时为空
+	Geo *geo.Info `json:"geo,omitempty"`
+	// ExitGeo 出口IP的地理位置与 ASN
+	ExitGeo *geo.Info `json:"exitGeo,omitempty"`
+	// NetworkType 出口网络类型: datacenter、residential、mobile 或 unknown
+	NetworkType string `json:"networkType,omitempty"`
+
+	// resolvedAddrs 域名代理在解析阶段得到的全部IP, 导出前复核名单时与解析阶段使用同一份结果
+	resolvedAddrs []netip.Addr
+}
+
+// ProxyAddress 🔑 返回检查时使用的地址, 有认证信息时为 "user:pass@IP:PORT"
+func (c Candidate) ProxyAddress() string {
+	return check.ProxyAddress(c.Address, c.Username, c.Password)
+}
+
+// IsZero 判断来源是否未声明任何属性
+func (c Claims) IsZero() bool {
+	return c == Claims{}
+}
+
+// merge 用另一份声明补全当前缺失的字段
+func (c Claims) merge(other Claims) Claims {
+	if c.Protocol == "" {
+		c.Protocol = other.Protocol
+	}
+	if c.Country == "" {
+		c.Country = other.Country
+	}
+	if c.Anonymity == "" {
+		c.Anonymity = other.Anonymity
+	}
+	return c
+}
+
+// newClaims 🏷️ 规范化来源页面中的原始声明文本
+//
+// 参数:
+//   - protocol: 协议列文本, 如 "HTTPS"、"SOCKS5"、"socks 5"
+//   - country: 国家列文本
+//   - anonymity: 匿名度列文本, 如 "elite proxy"、"高匿"
+//
+// 返回值:
+//   - Claims: 规范化后的声明
+func newClaims(protocol, country, anonymity string) Claims {
+	return Claims{
+		Protocol:  normalizeProtocol(protocol),
+		Country:   strings.TrimSpace(country),
+		Anonymity: normalizeAnonymity(anonymity),
+	}
+}
+
+// normalizeProtocol 将协议文本规范化为 http/https/socks4/socks5
+func normalizeProtocol(protocol string) string {
+	text := strings.ToLower(strings.Join(strings.Fields(protocol), ""))
+	switch {
+	case text == "":
+		return ""
+	case strings.Contains(text, "socks5") || strings.Contains(text, "sock5"):
+		return "socks5"
+	case strings.Contains(text, "socks4") || strings.Contains(text, "sock4"):
+		return "socks4"
+	case strings.Contains(text, "https"):
+		return "https"
+	case strings.Contains(text, "http"):
+		return "http"
+	}
+	return ""
+}
+
+// normalizeAnonymity 将匿名度文本规范化为与验证结果一致的 transparent/common/high
+func normalizeAnonymity(anonymity string) string {
+	text := strings.ToLower(strings.TrimSpace(anonymity))
+	switch {
+	case text == "":
+		return ""
+	case strings.Contains(text, "elite") || strings.Contains(text, "high") || strings.Contains(text, "高匿"):
+		return "high"
+	case strings.Contains(text, "transparent") || strings.Contains(text, "透明"):
+		return "transparent"
+	case strings.Contains(text, "anonymous") || strings.Contains(text, "匿"):
+		return "common"
+	}
+	return ""
+}
+
+// platformHints 🔖 返回平台级别的声明, 显式配置优先, 其次取URL中的 protocol 参数
+//
+// 参数:
+//   - platform: 平台配置
+//   - rawURL: 请求地址
+//
+// 返回值:
+//   - Claims: 适用于该地址全部代理的声明
+func platformHints(platform resource.PlatformConfig, rawURL string) Claims {
+	protocol := platform.Protocol
+	if protocol == "" {
+		if parsed, err := url.Parse(rawURL); err == nil {
+			protocol = parsed.Query().Get("protocol")
+		}
+	}
+	return Claims{Protocol: normalizeProtocol(protocol)}
+}
+
+// addressesToCandidates 将地址列表转换为不带声明的候选代理
+func addressesToCandidates(addresses []string, source string) []Candidate {
+	candidates := make([]Candidate, 0, len(addresses))
+	for _, address := range addresses {
+		candidates = append(candidates, Candidate{Address: address, Source: source})
+	}
+	return candidates
+}
+
+// candidateIndex 按地址去重的候选代理索引, 可被多个协程并发访问
+//
+// 候选代理按首次出现的地址去重, 重复出现时合并各来源的声明,
+// 检查完成后再读取合并后的声明, 因此检查期间到达的重复候选也不会丢失声明
+type candidateIndex struct {
+	mutex   sync.Mutex
+	entries map[string]*Candidate
+}
+
+// newCandidateIndex 创建空的候选代理索引
+func newCandidateIndex() *candidateIndex {
+	return &candidateIndex{entries: make(map[string]*Candidate)}
+}
+
+// add 🧹 记录候选代理, 地址需已规范化
+//
+// 参数:
+//   - candidate: 候选代理
+//
+// 返回值:
+//   - bool: 地址首次出现时为 true, 重复时合并声明和认证信息并返回 false
+func (i *candidateIndex) add(candidate Candidate) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if existing, ok := i.entries[candidate.Address]; ok {
+		existing.Hints = existing.Hints.merge(candidate.Hints)
+		if existing.Username == "" {
+			existing.Username, existing.Password = candidate.Username, candidate.Password
+		}
+		return false
+	}
+	i.entries[candidate.Address] = &candidate
+	return true
+}
+
+// claims 返回地址合并后的来源声明
+func (i *candidateIndex) claims(address string) Claims {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if existing, ok := i.entries[address]; ok {
+		return existing.Hints
+	}
+	return Claims{}
+}
+
+// sourceHonesty 各来源声明与验证结果的一致程度
+type sourceHonesty map[string]*honestyScore
+
+// honestyScore 单个来源的声明数与命中数
+type honestyScore struct {
+	protocolClaims, protocolHits, anonymityClaims, anonymityHits int
+}
+
+// add 📐 统计一条验证通过的代理记录
+func (h sourceHonesty) add(record ProxyRecord) {
+	if record.Claimed == nil || record.Source == "" {
+		return
+	}
+	s, ok := h[record.Source]
+	if !ok {
+		s = &honestyScore{}
+		h[record.Source] = s
+	}
+	if record.Claimed.Protocol != "" {
+		s.protocolClaims++
+		if record.supports(record.Claimed.Protocol) {
+			s.protocolHits++
+		}
+	}
+	if record.Claimed.Anonymity != "" {
+		s.anonymityClaims++
+		if record.Claimed.Anonymity == record.Anonymity {
+			s.anonymityHits++
+		}
+	}
+}
+
+// log 📐 按来源名称输出声明准确度
+func (h sourceHonesty) log() {
+	sources := make([]string, 0, len(h))
+	for source := range h {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	logger := logger.GetLogger()
+	for _, source := range sources {
+		s := h[source]
+		logger.Info(fmt.Sprintf("📐 来源 [%s] 声明准确度: 协议 %d/%d, 匿名度 %d/%d",
+			source, s.protocolHits, s.protocolClaims, s.anonymityHits, s.anonymityClaims))
+	}
+}
+
+// supports 判断验证结果是否支持指定协议
+func (r ProxyRecord) supports(protocol string) bool {
+	switch protocol {
+	case "http":
+		return r.Http
+	case "https":
+		return r.Https
+	case "socks5":
+		return r.Socks5
+	}
+	return false
+}
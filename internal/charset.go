@@ -0,0 +1,65 @@
+// Author       :loyd
+// Date         :2025-03-24 20:40:15
+// LastEditors  :loyd
+// LastEditTime :2025-03-24 21:28:37
+// Description  :代理源页面字符集识别与转码
+
+package internal
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// decodeContent 🈶 将响应内容转换为 UTF-8 字符串
+//
+// 识别顺序: 平台显式配置 > BOM > Content-Type 头 > HTML meta 标签;
+// 均未声明且内容不是合法 UTF-8 时按 GB18030 (兼容 GBK/GB2312) 解码
+//
+// 参数:
+//   - body: 原始响应内容
+//   - contentType: 响应头中的 Content-Type
+//   - declared: 平台配置的字符集, 为空表示自动识别
+//
+// 返回值:
+//   - string: UTF-8 编码的内容
+//   - string: 实际使用的字符集名称
+//   - error: 配置的字符集无效或转码失败时返回错误
+func decodeContent(body []byte, contentType, declared string) (string, string, error) {
+	var enc encoding.Encoding
+	var name string
+
+	if declared != "" {
+		var err error
+		enc, err = htmlindex.Get(declared)
+		if err != nil {
+			return "", "", fmt.Errorf("unknown charset %q: %w", declared, err)
+		}
+		name = declared
+	} else {
+		var certain bool
+		enc, name, certain = charset.DetermineEncoding(body, contentType)
+		// 未声明字符集时 DetermineEncoding 默认为 windows-1252, 这里改为按中文站点常见的 GBK 处理
+		if !certain && name == "windows-1252" {
+			if utf8.Valid(body) {
+				return string(body), "utf-8", nil
+			}
+			enc, name = simplifiedchinese.GB18030, "gb18030"
+		}
+	}
+
+	if name == "utf-8" {
+		return string(body), name, nil
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return "", name, fmt.Errorf("decode %s content: %w", name, err)
+	}
+	return string(decoded), name, nil
+}
@@ -0,0 +1,90 @@
+// Author       :loyd
+// Date         :2025-03-30 22:02:11
+// LastEditors  :loyd
+// LastEditTime :2025-03-30 23:16:40
+// Description  :Clash 订阅格式的代理解析
+
+package internal
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"zol9527/proxies/pkg/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// formatClash Clash 订阅 YAML 格式
+const formatClash = "clash"
+
+// clashSubscription Clash 订阅文件中与代理相关的部分
+type clashSubscription struct {
+	Proxies []clashProxy `yaml:"proxies"`
+}
+
+// clashProxy Clash 订阅中的单个代理节点
+type clashProxy struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Server   string `yaml:"server"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	TLS      bool   `yaml:"tls"`
+}
+
+// parseClashList 🐱 解析 Clash 订阅 YAML 中的 http / socks5 节点
+//
+// 其他类型(ss、vmess 等)无法作为普通代理使用, 会被跳过; 开启 tls 的 http 节点需要先与代理
+// 建立 TLS 连接, 检查流程只支持明文连接代理, 同样跳过; 节点的认证信息随候选代理传入检查流程
+//
+// 参数:
+//   - content: 订阅内容
+//
+// 返回值:
+//   - []Candidate: 候选代理
+func parseClashList(content string) []Candidate {
+	logger := logger.GetLogger()
+
+	var subscription clashSubscription
+	if err := yaml.Unmarshal([]byte(content), &subscription); err != nil {
+		logger.Warn(fmt.Sprintf("⚠️ Clash 订阅解析失败: %v", err))
+		return nil
+	}
+
+	var candidates []Candidate
+	skipped := 0
+	for _, proxy := range subscription.Proxies {
+		protocol := strings.ToLower(proxy.Type)
+		switch protocol {
+		case "http":
+			if proxy.TLS {
+				logger.Debug(fmt.Sprintf("⚠️ 跳过需要 TLS 连接的 Clash 节点 [%s]", proxy.Name))
+				skipped++
+				continue
+			}
+		case "socks5":
+		default:
+			skipped++
+			continue
+		}
+
+		record := extractedRecord{ip: proxy.Server, port: strconv.Itoa(proxy.Port), protocol: protocol}
+		address, ok := normalizeRecord(record)
+		if !ok {
+			logger.Debug(fmt.Sprintf("⚠️ 跳过无效的 Clash 节点 [%s]: %s", proxy.Name, net.JoinHostPort(proxy.Server, record.port)))
+			continue
+		}
+		candidates = append(candidates, Candidate{
+			Address:  address,
+			Username: proxy.Username,
+			Password: proxy.Password,
+			Hints:    Claims{Protocol: protocol},
+		})
+	}
+
+	logger.Info(fmt.Sprintf("🔢 从Clash订阅中提取到 %d 个代理, 跳过 %d 个不支持的节点", len(candidates), skipped))
+	return candidates
+}
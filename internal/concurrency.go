@@ -0,0 +1,268 @@
+// Author       :loyd
+// Date         :2025-04-12 21:26:10
+// LastEditors  :loyd
+// LastEditTime :2025-04-12 23:41:52
+// Description  :代理检查的自适应并发控制(AIMD): 本地失败率低时加性增加, 升高时乘性减少
+//
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"zol9527/proxies/pkg/check"
+	"zol9527/proxies/pkg/logger"
+)
+
+const (
+	// defaultAdaptiveMaxWorkers 开启自适应且未配置 check.workers 时的并发上限
+	defaultAdaptiveMaxWorkers = 512
+	// defaultAdaptiveMinWorkers 未配置 check.minWorkers 时的并发下限
+	defaultAdaptiveMinWorkers = 16
+	// adaptiveWindow 每个调整窗口至少观察的拨号次数, 并发较高时窗口取当前并发数, 减少抽样波动
+	adaptiveWindow = 32
+	// calibrationWindow 校准窗口的拨号次数, 比普通窗口大以减少基线的抽样波动
+	calibrationWindow = 64
+	// adaptiveIncrease 本地失败率低且并发已用满时每个窗口增加的并发数
+	adaptiveIncrease = 8
+	// exhaustedBackoffRate 资源耗尽的拨号比例超过该值时并发减半
+	exhaustedBackoffRate = 0.05
+	// timeoutGrowExcess 超时率高出基线不到该值且没有资源耗尽时增加并发
+	timeoutGrowExcess = 0.05
+	// timeoutBackoffExcess 超时率高出基线超过该值时并发减半, 需大于窗口内超时率的抽样波动
+	timeoutBackoffExcess = 0.15
+	// baselineRise/baselineFall 基线每个窗口向更高/更低超时率靠拢的比例, 上升缓慢以免把过载当作基线
+	baselineRise = 0.05
+	baselineFall = 0.2
+	// controlInterval 对照地址的拨号间隔
+	controlInterval = 5 * time.Second
+	// controlTimeout 对照地址的拨号超时, 已知可用的地址超时说明本机已经过载
+	controlTimeout = 3 * time.Second
+)
+
+// adaptiveLimiter 按本地失败率调整同时进行的检查数量
+//
+// 端口耗尽、文件句柄不足等本机错误直接计为本地失败; 拨号超时既可能是本机过载也可能是代理不可达,
+// 只有超时率高出基线的部分计为本地失败; 对照地址拨号失败时立即减半。
+// 基线取自以并发下限运行的第一个窗口(校准窗口), 校准完成后并发才升到初始值,
+// 避免初始并发本身已经过载时把过载的超时率当作基线
+type adaptiveLimiter struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	min      int
+	max      int
+	inflight int
+	// peak 当前窗口内同时进行的最大检查数, 并发未用满时不再增加
+	peak int
+	// dials 当前窗口的拨号次数, exhausted 与 timeouts 为其中资源耗尽和超时的次数
+	dials     int
+	exhausted int
+	timeouts  int
+	// baseline 超时率基线, 小于 0 表示还在校准
+	baseline float64
+	// start 校准完成后使用的初始并发
+	start int
+	// lowest/highest 本轮出现过的并发范围, 用于结束时的汇总
+	lowest  int
+	highest int
+}
+
+// newAdaptiveLimiter 🎚️ 创建自适应并发控制器
+//
+// 先以并发下限校准超时率基线, 校准完成后升到默认检查协程数(限制在 [min, max] 内)
+//
+// 参数:
+//   - minWorkers: 并发下限, 0 表示使用默认值
+//   - maxWorkers: 并发上限
+//
+// 返回值:
+//   - *adaptiveLimiter: 并发控制器
+func newAdaptiveLimiter(minWorkers, maxWorkers int) *adaptiveLimiter {
+	if minWorkers <= 0 {
+		minWorkers = defaultAdaptiveMinWorkers
+	}
+	minWorkers = min(minWorkers, maxWorkers)
+	start := min(max(defaultCheckWorkers, minWorkers), maxWorkers)
+
+	limiter := &adaptiveLimiter{limit: minWorkers, min: minWorkers, max: maxWorkers, baseline: -1, start: start, lowest: minWorkers, highest: minWorkers}
+	limiter.cond = sync.NewCond(&limiter.mutex)
+	return limiter
+}
+
+// acquire ⏳ 等待可用的并发名额, 成功返回时占用一个名额
+//
+// 参数:
+//   - ctx: 等待期间被取消时放弃获取
+//
+// 返回值:
+//   - error: ctx 被取消时返回其错误, 此时不占用名额
+func (l *adaptiveLimiter) acquire(ctx context.Context) error {
+	// ctx 取消时唤醒等待者, 持锁广播保证不会错过正在进入等待的协程
+	stop := context.AfterFunc(ctx, func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.cond.Broadcast()
+	})
+	defer stop()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if l.inflight < l.limit {
+			break
+		}
+		l.cond.Wait()
+	}
+	l.inflight++
+	if l.inflight > l.peak {
+		l.peak = l.inflight
+	}
+	return nil
+}
+
+// release 归还并发名额
+func (l *adaptiveLimiter) release() {
+	l.mutex.Lock()
+	l.inflight--
+	l.mutex.Unlock()
+	l.cond.Signal()
+}
+
+// observeDial 作为检查器的拨号观察函数, 统计拨号结果, 窗口样本足够时调整并发
+func (l *adaptiveLimiter) observeDial(address string, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.dials++
+	switch {
+	case check.IsResourceExhausted(err):
+		l.exhausted++
+	case check.IsDialTimeout(err):
+		l.timeouts++
+	}
+	if l.baseline < 0 {
+		if l.dials >= calibrationWindow {
+			l.calibrate()
+		}
+		return
+	}
+	if l.dials < max(adaptiveWindow, l.limit) {
+		return
+	}
+
+	exhaustedRate := float64(l.exhausted) / float64(l.dials)
+	timeoutRate := float64(l.timeouts) / float64(l.dials)
+	excess := max(timeoutRate-l.baseline, 0)
+	if timeoutRate < l.baseline {
+		l.baseline += (timeoutRate - l.baseline) * baselineFall
+	} else {
+		l.baseline += (timeoutRate - l.baseline) * baselineRise
+	}
+	reason := fmt.Sprintf("资源耗尽 %.1f%%, 超时率 %.1f%% (基线 %.1f%%)", exhaustedRate*100, timeoutRate*100, l.baseline*100)
+
+	switch {
+	case exhaustedRate > exhaustedBackoffRate || excess > timeoutBackoffExcess:
+		l.resize(max(l.limit/2, l.min), reason)
+	case l.exhausted == 0 && excess < timeoutGrowExcess && l.peak >= l.limit:
+		l.resize(min(l.limit+adaptiveIncrease, l.max), reason)
+	}
+	l.dials, l.exhausted, l.timeouts, l.peak = 0, 0, 0, l.inflight
+}
+
+// calibrate 用并发下限下的校准窗口设置超时率基线, 没有资源耗尽时升到初始并发, 调用方需持有锁
+func (l *adaptiveLimiter) calibrate() {
+	exhaustedRate := float64(l.exhausted) / float64(l.dials)
+	l.baseline = float64(l.timeouts) / float64(l.dials)
+	reason := fmt.Sprintf("基线校准完成: 资源耗尽 %.1f%%, 超时率 %.1f%%", exhaustedRate*100, l.baseline*100)
+	if exhaustedRate <= exhaustedBackoffRate {
+		l.resize(l.start, reason)
+	} else {
+		logger.GetLogger().Warn(fmt.Sprintf("📉 %s, 保持检查并发 %d", reason, l.limit))
+	}
+	l.dials, l.exhausted, l.timeouts, l.peak = 0, 0, 0, l.inflight
+}
+
+// backoff 立即将并发减半, 用于对照地址拨号失败等明确的本机过载信号; 校准期间降低校准后的初始并发
+func (l *adaptiveLimiter) backoff(reason string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.baseline < 0 {
+		l.start = max(l.start/2, l.min)
+		logger.GetLogger().Warn(fmt.Sprintf("📉 %s, 校准后的初始并发降为 %d", reason, l.start))
+		return
+	}
+	l.resize(max(l.limit/2, l.min), reason)
+	l.dials, l.exhausted, l.timeouts, l.peak = 0, 0, 0, l.inflight
+}
+
+// resize 调整并发并记录范围, 调用方需持有锁
+func (l *adaptiveLimiter) resize(limit int, reason string) {
+	previous := l.limit
+	if limit == previous {
+		return
+	}
+	l.limit = limit
+	l.lowest = min(l.lowest, limit)
+	l.highest = max(l.highest, limit)
+	if limit < previous {
+		logger.GetLogger().Warn(fmt.Sprintf("📉 %s, 检查并发 %d -> %d", reason, previous, limit))
+		return
+	}
+	logger.GetLogger().Debug(fmt.Sprintf("📈 %s, 检查并发 %d -> %d", reason, previous, limit))
+	l.cond.Broadcast()
+}
+
+// watchControls 🎯 定期拨号已知可用的对照地址, 任一地址拨号失败时立即减半并发, ctx 取消后返回
+//
+// 对照结果不与代理拨号混在同一窗口: 对照拨号远少于代理拨号, 混在一起时失败永远达不到阈值
+//
+// 参数:
+//   - ctx: 取消时停止拨号
+//   - controls: 对照地址(host:port)
+func (l *adaptiveLimiter) watchControls(ctx context.Context, controls []string) {
+	if len(controls) == 0 {
+		return
+	}
+	ticker := time.NewTicker(controlInterval)
+	defer ticker.Stop()
+
+	dialer := net.Dialer{Timeout: controlTimeout}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// 同一轮中多个对照地址失败只减半一次
+		var failed string
+		for _, address := range controls {
+			conn, err := dialer.DialContext(ctx, "tcp", address)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logger.GetLogger().Debug(fmt.Sprintf("🎯 对照地址 %s 拨号失败: %v", address, err))
+				failed = address
+				continue
+			}
+			conn.Close()
+		}
+		if failed != "" {
+			l.backoff(fmt.Sprintf("对照地址 %s 拨号失败", failed))
+		}
+	}
+}
+
+// summary 返回本轮的并发范围
+func (l *adaptiveLimiter) summary() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return fmt.Sprintf("%d (范围 %d~%d)", l.limit, l.lowest, l.highest)
+}
@@ -0,0 +1,120 @@
+// Author       :loyd
+// Date         :2025-04-14 20:05:18
+// LastEditors  :loyd
+// LastEditTime :2025-04-14 20:58:33
+// Description  :自适应检查并发(AIMD)的调整逻辑测试
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"math"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// limiterStep 一个拨号窗口或一次对照地址失败
+type limiterStep struct {
+	// timeouts/exhausted 窗口内拨号超时和资源耗尽的比例
+	timeouts  float64
+	exhausted float64
+	// control 为 true 时不拨号, 模拟一次对照地址拨号失败
+	control bool
+}
+
+// feedWindow 按比例送入一个完整窗口的拨号结果, 并模拟并发已用满
+func feedWindow(limiter *adaptiveLimiter, step limiterStep) {
+	size := max(adaptiveWindow, limiter.limit)
+	if limiter.baseline < 0 {
+		size = calibrationWindow
+	}
+	exhausted := int(math.Round(float64(size) * step.exhausted))
+	timeouts := int(math.Round(float64(size) * step.timeouts))
+
+	limiter.mutex.Lock()
+	limiter.peak = limiter.limit
+	limiter.mutex.Unlock()
+	for i := 0; i < size; i++ {
+		var err error
+		switch {
+		case i < exhausted:
+			err = syscall.EMFILE
+		case i < exhausted+timeouts:
+			err = context.DeadlineExceeded
+		}
+		limiter.observeDial("203.0.113.1:8080", err)
+	}
+}
+
+// TestAdaptiveLimiter 校验校准、增长、超时回退、资源耗尽回退和对照地址回退
+func TestAdaptiveLimiter(t *testing.T) {
+	repeat := func(step limiterStep, n int) []limiterStep {
+		steps := make([]limiterStep, n)
+		for i := range steps {
+			steps[i] = step
+		}
+		return steps
+	}
+
+	tests := []struct {
+		name  string
+		steps []limiterStep
+		want  int
+	}{
+		{"calibrates at min before starting", nil, 16},
+		{"starts at default after calibration", []limiterStep{{timeouts: 0.5}}, 128},
+		{"exhaustion during calibration keeps min", []limiterStep{{timeouts: 0.5, exhausted: 0.1}}, 16},
+		{"timeouts at baseline still grow", []limiterStep{{timeouts: 0.6}, {timeouts: 0.6}}, 136},
+		{"healthy windows grow up to max", repeat(limiterStep{timeouts: 0.1}, 61), 512},
+		{"timeout rate above baseline backs off", []limiterStep{{timeouts: 0.3}, {timeouts: 0.6}}, 64},
+		{"small timeout excess holds", []limiterStep{{timeouts: 0.3}, {timeouts: 0.4}}, 128},
+		{"resource exhaustion backs off", []limiterStep{{timeouts: 0.3}, {timeouts: 0.3, exhausted: 0.1}}, 64},
+		{"control failure backs off immediately", []limiterStep{{timeouts: 0.3}, {control: true}}, 64},
+		{"control failure during calibration lowers start", []limiterStep{{control: true}, {timeouts: 0.3}}, 64},
+		{"backoff stops at min", append([]limiterStep{{timeouts: 0.3}}, repeat(limiterStep{control: true}, 10)...), 16},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := newAdaptiveLimiter(16, 512)
+			for _, step := range test.steps {
+				if step.control {
+					limiter.backoff("对照地址 192.0.2.1:80 拨号失败")
+					continue
+				}
+				feedWindow(limiter, step)
+			}
+			if limiter.limit != test.want {
+				t.Errorf("limit = %d, want %d", limiter.limit, test.want)
+			}
+		})
+	}
+}
+
+// TestAdaptiveLimiterAcquireCanceled 校验名额已满时取消 ctx 能结束等待且不占用名额
+func TestAdaptiveLimiterAcquireCanceled(t *testing.T) {
+	limiter := newAdaptiveLimiter(1, 1)
+	if err := limiter.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- limiter.acquire(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("acquire returned %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire did not return after cancel")
+	}
+	if limiter.inflight != 1 {
+		t.Errorf("inflight = %d, want 1", limiter.inflight)
+	}
+}
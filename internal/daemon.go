@@ -0,0 +1,59 @@
+// Author       :loyd
+// Date         :2025-03-14 22:31:09
+// LastEditors  :loyd
+// LastEditTime :2025-03-14 22:58:40
+// Description  :长驻模式, 周期性执行爬取并热加载配置
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"zol9527/proxies/pkg/logger"
+	"zol9527/proxies/pkg/resource"
+)
+
+const (
+	// defaultRunInterval 未配置 pool.interval 时两次爬取之间的间隔
+	defaultRunInterval = 30 * time.Minute
+	// reloadPollInterval 轮询配置文件变化的间隔
+	reloadPollInterval = 5 * time.Second
+)
+
+// RunDaemon 😈 以长驻模式周期性执行爬取
+//
+// 每轮开始时读取 watcher 中当前生效的配置, 配置文件的修改或 SIGHUP
+// 会在下一轮生效, 两轮之间的间隔取自 pool.interval
+//
+// 参数:
+//   - ctx: 控制长驻模式生命周期的上下文
+//   - configPath: 命令行指定的配置文件路径
+//   - overrides: 命令行覆盖项
+func RunDaemon(ctx context.Context, configPath string, overrides []string) {
+	logger := logger.GetLogger()
+
+	watcher, err := resource.NewWatcher(configPath, overrides, reloadPollInterval)
+	if err != nil {
+		panic(err)
+	}
+	go watcher.Run(ctx)
+
+	for {
+		config := watcher.Current()
+		Scrape(ctx, config)
+
+		interval := defaultRunInterval
+		if config.Pool.Interval > 0 {
+			interval = time.Duration(config.Pool.Interval) * time.Second
+		}
+		logger.Info(fmt.Sprintf("⏰ 本轮爬取完成, %s 后开始下一轮", interval))
+
+		select {
+		case <-ctx.Done():
+			logger.Info("👋 长驻模式已退出")
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Author       :loyd
+// Date         :2025-03-26 20:18:52
+// LastEditors  :loyd
+// LastEditTime :2025-03-27 00:14:09
+// Description  :代理源页面的端口/IP反混淆解码器
+
+package internal
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"zol9527/proxies/pkg/logger"
+	"zol9527/proxies/pkg/resource"
+)
+
+// contentDecoder 对页面内容做一次反混淆变换, 无法识别的部分保持原样
+type contentDecoder func(content string) string
+
+// contentDecoders 可在 [[platform]] 的 decode 中按名称启用的解码器, 按声明顺序依次执行,
+// 名称需同时登记在 resource.DecoderNames 中以便加载配置时校验
+var contentDecoders = map[string]contentDecoder{
+	"xor":             decodeXorVariables,
+	"base64":          decodeBase64Calls,
+	"hex":             decodeHexEscapes,
+	"document-write":  decodeDocumentWrite,
+	"port-class-map":  decodePortClassMap,
+	"hidden-elements": removeHiddenElements,
+}
+
+var (
+	// base64CallPattern 匹配 Base64.decode("...") 与 atob("...")
+	base64CallPattern = regexp.MustCompile(`(?:Base64\.decode|(?:window\.)?atob)\(\s*["']([A-Za-z0-9+/=_-]+)["']\s*\)`)
+	// hexEscapePattern 匹配 JavaScript 字符串中的 \xNN 与 \uNNNN 转义
+	hexEscapePattern = regexp.MustCompile(`\\x([0-9A-Fa-f]{2})|\\u([0-9A-Fa-f]{4})`)
+	// scriptPattern 匹配完整的 script 元素
+	scriptPattern = regexp.MustCompile(`(?is)<script[^>]*>(.*?)</script>`)
+	// documentWritePattern 匹配 document.write(...) 调用, 参数中允许一层括号
+	documentWritePattern = regexp.MustCompile(`document\.write(?:ln)?\(((?:[^()]|\([^()]*\))*)\)\s*;?`)
+	// portClassPattern 匹配 class 中带有 "port 字母串" 的元素
+	portClassPattern = regexp.MustCompile(`(<[a-zA-Z]+[^>]*\bclass\s*=\s*["'][^"']*\bport\s+([A-Z]+)\b[^"']*["'][^>]*>)[^<]*(</[a-zA-Z]+>)`)
+	// hiddenElementPattern 匹配 display:none 的行内元素
+	hiddenElementPattern = regexp.MustCompile(`(?i)<(?:p|span|div|i|b|em|font)\b[^>]*display\s*:\s*none[^>]*>[^<]*</(?:p|span|div|i|b|em|font)>`)
+	// xorAssignPattern 匹配形如 a1=8051; b2=3^a1; 的变量赋值
+	xorAssignPattern = regexp.MustCompile(`([A-Za-z_$][\w$]*)\s*=\s*([\w$]+(?:\s*\^\s*[\w$]+)*)\s*;`)
+	// xorExprPattern 匹配形如 (a1^b2) 的异或表达式
+	xorExprPattern = regexp.MustCompile(`\(\s*([\w$]+(?:\s*\^\s*[\w$]+)+)\s*\)`)
+)
+
+// portClassAlphabet 端口类名中字母到数字的映射, 字母下标即对应数字
+const portClassAlphabet = "ABCDEFGHIZ"
+
+// applyDecoders 🔓 按平台配置依次执行反混淆解码器
+//
+// 参数:
+//   - platform: 平台配置, decode 中声明启用的解码器
+//   - content: 页面内容
+//
+// 返回值:
+//   - string: 解码后的页面内容
+func applyDecoders(platform resource.PlatformConfig, content string) string {
+	for _, name := range platform.Decode {
+		decoder, ok := contentDecoders[name]
+		if !ok {
+			logger.GetLogger().Warn(fmt.Sprintf("⚠️ 平台 [%s] 使用了未知的解码器: %s", platform.Name, name))
+			continue
+		}
+		content = decoder(content)
+	}
+	return content
+}
+
+// decodeBase64Calls 🧬 将 Base64.decode("...") / atob("...") 替换为解码后的字符串字面量
+func decodeBase64Calls(content string) string {
+	return base64CallPattern.ReplaceAllStringFunc(content, func(call string) string {
+		encoded := base64CallPattern.FindStringSubmatch(call)[1]
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			decoded, err = base64.URLEncoding.DecodeString(encoded)
+		}
+		if err != nil {
+			return call
+		}
+		return strconv.Quote(string(decoded))
+	})
+}
+
+// decodeHexEscapes 🔣 将 \xNN 与 \uNNNN 转义还原为字符
+func decodeHexEscapes(content string) string {
+	return hexEscapePattern.ReplaceAllStringFunc(content, func(escape string) string {
+		code, err := strconv.ParseUint(escape[2:], 16, 32)
+		if err != nil {
+			return escape
+		}
+		return string(rune(code))
+	})
+}
+
+// decodeDocumentWrite 📝 将仅由字面量拼接组成的 document.write 调用替换为输出内容
+//
+// 只包含 document.write 的 script 元素会被整体替换, 以便表格解析能读到单元格文本
+func decodeDocumentWrite(content string) string {
+	content = scriptPattern.ReplaceAllStringFunc(content, func(script string) string {
+		body := scriptPattern.FindStringSubmatch(script)[1]
+		calls := documentWritePattern.FindAllStringSubmatch(body, -1)
+		if len(calls) == 0 || strings.TrimSpace(documentWritePattern.ReplaceAllString(body, "")) != "" {
+			return script
+		}
+
+		var output strings.Builder
+		for _, call := range calls {
+			text, ok := evaluateConcat(call[1])
+			if !ok {
+				return script
+			}
+			output.WriteString(text)
+		}
+		return output.String()
+	})
+
+	return documentWritePattern.ReplaceAllStringFunc(content, func(call string) string {
+		text, ok := evaluateConcat(documentWritePattern.FindStringSubmatch(call)[1])
+		if !ok {
+			return call
+		}
+		return text
+	})
+}
+
+// evaluateConcat 计算由字符串字面量、数字和 + 组成的表达式
+func evaluateConcat(expression string) (string, bool) {
+	var result strings.Builder
+
+	for _, term := range splitConcat(expression) {
+		term = strings.TrimSpace(term)
+		for strings.HasPrefix(term, "(") && strings.HasSuffix(term, ")") {
+			term = strings.TrimSpace(term[1 : len(term)-1])
+		}
+
+		switch {
+		case len(term) >= 2 && (term[0] == '"' || term[0] == '\'') && term[len(term)-1] == term[0]:
+			result.WriteString(unescapeJSString(term[1 : len(term)-1]))
+		case term != "" && strings.Trim(term, "0123456789") == "":
+			result.WriteString(term)
+		default:
+			return "", false
+		}
+	}
+
+	return result.String(), true
+}
+
+// splitConcat 在引号和括号之外按 + 拆分表达式
+func splitConcat(expression string) []string {
+	var terms []string
+	var quote rune
+	depth, start := 0, 0
+
+	for i, r := range expression {
+		switch {
+		case quote != 0:
+			if r == quote && (i == 0 || expression[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == '+' && depth == 0:
+			terms = append(terms, expression[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(terms, expression[start:])
+}
+
+// unescapeJSString 还原 JavaScript 字符串字面量中的常见转义
+func unescapeJSString(text string) string {
+	replacer := strings.NewReplacer(`\/`, `/`, `\"`, `"`, `\'`, `'`, `\n`, "\n", `\t`, "\t", `\\`, `\`)
+	return decodeHexEscapes(replacer.Replace(text))
+}
+
+// decodePortClassMap 🔢 还原以类名字母编码的端口
+//
+// 形如 <span class="port GEGEA">9999</span> 的元素中, 可见文本是假端口,
+// 类名字母按 ABCDEFGHIZ 映射为数字后右移 3 位才是真实端口
+func decodePortClassMap(content string) string {
+	return portClassPattern.ReplaceAllStringFunc(content, func(element string) string {
+		matches := portClassPattern.FindStringSubmatch(element)
+		var digits strings.Builder
+		for _, letter := range matches[2] {
+			index := strings.IndexRune(portClassAlphabet, letter)
+			if index < 0 {
+				return element
+			}
+			digits.WriteString(strconv.Itoa(index))
+		}
+
+		value, err := strconv.Atoi(digits.String())
+		if err != nil {
+			return element
+		}
+		return matches[1] + strconv.Itoa(value>>3) + matches[3]
+	})
+}
+
+// removeHiddenElements 🙈 移除 display:none 的干扰元素, 避免隐藏数字混入IP文本
+func removeHiddenElements(content string) string {
+	return hiddenElementPattern.ReplaceAllString(content, "")
+}
+
+// decodeXorVariables ⊕ 计算脚本中的异或变量并替换 (a^b) 表达式为数字
+//
+// 形如 a1=8051;b2=3^a1; 的赋值按出现顺序求值, 随后页面中
+// 所有可求值的 (x^y) 表达式都会被替换为十进制结果
+func decodeXorVariables(content string) string {
+	variables := make(map[string]int)
+
+	for _, assignment := range xorAssignPattern.FindAllStringSubmatch(content, -1) {
+		if value, ok := evaluateXor(assignment[2], variables); ok {
+			variables[assignment[1]] = value
+		}
+	}
+	if len(variables) == 0 {
+		return content
+	}
+
+	return xorExprPattern.ReplaceAllStringFunc(content, func(expression string) string {
+		value, ok := evaluateXor(xorExprPattern.FindStringSubmatch(expression)[1], variables)
+		if !ok {
+			return expression
+		}
+		return strconv.Itoa(value)
+	})
+}
+
+// evaluateXor 计算由数字和已知变量组成的异或表达式
+func evaluateXor(expression string, variables map[string]int) (int, bool) {
+	result := 0
+	for _, operand := range strings.Split(expression, "^") {
+		operand = strings.TrimSpace(operand)
+		value, err := strconv.Atoi(operand)
+		if err != nil {
+			known, ok := variables[operand]
+			if !ok {
+				return 0, false
+			}
+			value = known
+		}
+		result ^= value
+	}
+	return result, true
+}
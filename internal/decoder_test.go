@@ -0,0 +1,97 @@
+// Author       :loyd
+// Date         :2025-04-13 15:06:27
+// LastEditors  :loyd
+// LastEditTime :2025-04-13 16:12:40
+// Description  :反混淆解码器测试, 样例页面保存在 testdata/decoder 中
+
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"zol9527/proxies/pkg/resource"
+)
+
+// TestDecoders 对保存的页面样例执行解码器并解析, 校验得到的 ip:port
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		sample string
+		decode []string
+		want   []string
+	}{
+		{
+			sample: "xor.html",
+			decode: []string{"xor", "document-write"},
+			want:   []string{"45.76.14.201:8080", "139.59.1.14:3128", "103.152.112.162:80"},
+		},
+		{
+			sample: "base64.html",
+			decode: []string{"base64", "document-write"},
+			want:   []string{"195.154.222.238:3128", "188.132.222.5:8080"},
+		},
+		{
+			sample: "hex.html",
+			decode: []string{"hex"},
+			want:   []string{"185.199.229.156:7492", "51.158.154.173:3128", "47.88.29.108:80"},
+		},
+		{
+			sample: "document-write.html",
+			decode: []string{"document-write"},
+			want:   []string{"103.152.112.162:80", "8.219.97.248:8080"},
+		},
+		{
+			sample: "port-class-map.html",
+			decode: []string{"port-class-map"},
+			want:   []string{"89.187.177.93:8080", "154.236.177.101:3510", "178.48.68.61:906"},
+		},
+		{
+			sample: "hidden-elements.html",
+			decode: []string{"hidden-elements"},
+			want:   []string{"185.199.65.41:8080", "51.158.154.173:3128"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.TrimSuffix(test.sample, ".html"), func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", "decoder", test.sample))
+			if err != nil {
+				t.Fatal(err)
+			}
+			platform := resource.PlatformConfig{Name: test.sample, Decode: test.decode}
+
+			// 未解码时样例中的代理不能被完整解析, 否则样例起不到测试作用
+			if got := candidateAddresses(ExtractProxies(platform, string(content))); slices.Equal(got, test.want) {
+				t.Fatalf("sample %s parses without decoders", test.sample)
+			}
+
+			got := candidateAddresses(ExtractProxies(platform, applyDecoders(platform, string(content))))
+			if !slices.Equal(got, test.want) {
+				t.Errorf("decode %v: got %v, want %v", test.decode, got, test.want)
+			}
+		})
+	}
+}
+
+// candidateAddresses 返回候选代理的地址列表
+func candidateAddresses(candidates []Candidate) []string {
+	addresses := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		addresses = append(addresses, candidate.Address)
+	}
+	return addresses
+}
+
+// TestDecoderNames 校验 resource.DecoderNames 与已注册的解码器一致, 避免配置校验与运行时不同步
+func TestDecoderNames(t *testing.T) {
+	if len(resource.DecoderNames) != len(contentDecoders) {
+		t.Fatalf("resource.DecoderNames has %d names, %d decoders registered", len(resource.DecoderNames), len(contentDecoders))
+	}
+	for _, name := range resource.DecoderNames {
+		if _, ok := contentDecoders[name]; !ok {
+			t.Errorf("decoder %q is not registered", name)
+		}
+	}
+}
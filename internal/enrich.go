@@ -0,0 +1,117 @@
+// Author       :loyd
+// Date         :2025-04-04 20:06:13
+// LastEditors  :loyd
+// LastEditTime :2025-04-04 22:18:40
+// Description  :验证结果的地理位置补全与导出条件过滤
+
+package internal
+
+import (
+	"net/netip"
+	"strings"
+	"zol9527/proxies/pkg/geo"
+	"zol9527/proxies/pkg/resource"
+
+	"github.com/duke-git/lancet/v2/slice"
+)
+
+// enrichRecord 🗺️ 为验证结果补全监听IP与出口IP的国家、城市、ASN 和组织
+//
+// 参数:
+//   - locator: 离线数据库查询器, 为 nil 时不补全
+//   - record: 验证结果
+//
+// 返回值:
+//   - bool: 是否查询到任一IP的信息
+func enrichRecord(locator *geo.Locator, record *ProxyRecord) bool {
+	if locator == nil {
+		return false
+	}
+	record.Geo = lookupGeo(locator, listenIP(*record))
+	record.ExitGeo = lookupGeo(locator, record.ExitIP)
+	return record.Geo != nil || record.ExitGeo != nil
+}
+
+// exportFilter 按 [output] 条件筛选导出的记录
+type exportFilter struct {
+	countries    []string
+	networkTypes []string
+}
+
+// newExportFilter 根据导出条件创建筛选器, 国家统一为大写, 网络类型统一为小写
+func newExportFilter(config resource.OutputConfig) exportFilter {
+	return exportFilter{
+		countries: slice.Map(config.Countries, func(_ int, country string) string {
+			return strings.ToUpper(strings.TrimSpace(country))
+		}),
+		networkTypes: slice.Map(config.NetworkTypes, func(_ int, networkType string) string {
+			return strings.ToLower(strings.TrimSpace(networkType))
+		}),
+	}
+}
+
+// enabled 是否配置了任一导出条件
+func (f exportFilter) enabled() bool {
+	return len(f.countries) > 0 || len(f.networkTypes) > 0
+}
+
+// allow 📤 判断记录是否满足导出条件
+//
+// 国家优先使用出口IP的国家, 没有时使用监听IP的国家, 两者都未知的记录不会导出;
+// 未标记网络类型的记录视为 unknown
+//
+// 参数:
+//   - record: 已补全地理位置和网络类型的验证结果
+//
+// 返回值:
+//   - bool: 是否导出
+func (f exportFilter) allow(record ProxyRecord) bool {
+	if len(f.countries) > 0 && !slice.Contain(f.countries, strings.ToUpper(record.country())) {
+		return false
+	}
+	if len(f.networkTypes) > 0 && !slice.Contain(f.networkTypes, record.networkType()) {
+		return false
+	}
+	return true
+}
+
+// country 返回代理对外表现的国家, 出口IP优先
+func (r ProxyRecord) country() string {
+	if r.ExitGeo != nil && r.ExitGeo.Country != "" {
+		return r.ExitGeo.Country
+	}
+	if r.Geo != nil {
+		return r.Geo.Country
+	}
+	return ""
+}
+
+// networkType 返回记录的网络类型, 未分类时为 unknown
+func (r ProxyRecord) networkType() string {
+	if r.NetworkType == "" {
+		return networkUnknown
+	}
+	return r.NetworkType
+}
+
+// listenIP 返回代理监听地址的IP, 域名代理使用检查时解析到的IP
+func listenIP(record ProxyRecord) string {
+	if record.Resolved != "" {
+		return record.Resolved
+	}
+	host, _, _ := splitAddress(record.IP)
+	return host
+}
+
+// lookupGeo 查询单个IP, IP无效或查询不到任何信息时返回 nil
+func lookupGeo(locator *geo.Locator, ip string) *geo.Info {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	info := locator.Lookup(addr)
+	if info.IsZero() {
+		return nil
+	}
+	return &info
+}
@@ -0,0 +1,314 @@
+// Author       :loyd
+// Date         :2025-03-20 20:12:48
+// LastEditors  :loyd
+// LastEditTime :2025-03-20 22:35:06
+// Description  :按平台声明的规则提取代理
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"zol9527/proxies/pkg/logger"
+	"zol9527/proxies/pkg/resource"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// portPattern 从单元格文本中提取端口号
+var portPattern = regexp.MustCompile(`\d{1,5}`)
+
+// jsonPathSegment 匹配路径片段中的字段名与下标, 例如 list[*]、items[0]
+var jsonPathSegment = regexp.MustCompile(`^([^\[\]]*)((?:\[(?:\*|\d+)\])*)$`)
+
+// extractedRecord 提取规则得到的一条原始记录
+type extractedRecord struct {
+	ip        string
+	port      string
+	protocol  string
+	country   string
+	anonymity string
+}
+
+// ExtractProxies 🧲 按平台配置从页面内容中提取代理
+//
+// 平台声明了 extractor 时只使用该规则, 否则按 format 解析列表格式,
+// html 或无法识别的内容回退到 ParseURLs 的启发式解析
+//
+// 参数:
+//   - platform: 平台配置
+//   - content: 页面内容
+//
+// 返回值:
+//   - []Candidate: 提取到的候选代理, 携带记录中声明的协议、国家和匿名度
+func ExtractProxies(platform resource.PlatformConfig, content string) []Candidate {
+	if platform.Extractor == nil {
+		return parseByFormat(strings.ToLower(platform.Format), content)
+	}
+
+	logger := logger.GetLogger()
+	records, err := extractRecords(platform.Extractor, content)
+	if err != nil {
+		logger.Error(fmt.Sprintf("❌ 平台 [%s] 提取规则执行失败: %v", platform.Name, err))
+		return nil
+	}
+
+	var candidates []Candidate
+	for _, record := range records {
+		if ipPort, ok := normalizeRecord(record); ok {
+			candidates = append(candidates, Candidate{
+				Address: ipPort,
+				Hints:   newClaims(record.protocol, record.country, record.anonymity),
+			})
+		}
+	}
+
+	logger.Info(fmt.Sprintf("🔢 平台 [%s] 按 %s 规则提取到 %d 个IP地址", platform.Name, platform.Extractor.Type, len(candidates)))
+	return candidates
+}
+
+// extractRecords 📑 根据规则类型执行提取
+//
+// 参数:
+//   - rule: 提取规则
+//   - content: 页面内容
+//
+// 返回值:
+//   - []extractedRecord: 提取到的原始记录
+//   - error: 页面无法按规则解析时返回错误
+func extractRecords(rule *resource.ExtractorConfig, content string) ([]extractedRecord, error) {
+	switch rule.Type {
+	case "css":
+		return extractByCSS(rule, content)
+	case "regex":
+		return extractByRegex(rule, content)
+	case "json":
+		return extractByJSON(rule, content)
+	}
+	return nil, fmt.Errorf("unknown extractor type %q", rule.Type)
+}
+
+// extractByCSS 🎨 使用CSS选择器逐行提取
+func extractByCSS(rule *resource.ExtractorConfig, content string) ([]extractedRecord, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var records []extractedRecord
+	doc.Find(rule.Row).Each(func(_ int, row *goquery.Selection) {
+		records = append(records, extractedRecord{
+			ip:        selectValue(row, rule.IP),
+			port:      selectValue(row, rule.Port),
+			protocol:  selectValue(row, rule.Protocol),
+			country:   selectValue(row, rule.Country),
+			anonymity: selectValue(row, rule.Anonymity),
+		})
+	})
+	return records, nil
+}
+
+// selectValue 读取行内选择器命中的文本, "选择器@属性" 形式读取属性值
+func selectValue(row *goquery.Selection, selector string) string {
+	if selector == "" {
+		return ""
+	}
+
+	selector, attr, hasAttr := strings.Cut(selector, "@")
+	selection := row
+	if strings.TrimSpace(selector) != "" {
+		selection = row.Find(selector).First()
+	}
+	if hasAttr {
+		value, _ := selection.Attr(attr)
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(selection.Text())
+}
+
+// extractByRegex 🧵 使用命名分组正则提取
+func extractByRegex(rule *resource.ExtractorConfig, content string) ([]extractedRecord, error) {
+	pattern, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	group := func(match []string, name string) string {
+		if index := pattern.SubexpIndex(name); index >= 0 {
+			return match[index]
+		}
+		return ""
+	}
+
+	var records []extractedRecord
+	for _, match := range pattern.FindAllStringSubmatch(content, -1) {
+		records = append(records, extractedRecord{
+			ip:        group(match, "ip"),
+			port:      group(match, "port"),
+			protocol:  group(match, "protocol"),
+			country:   group(match, "country"),
+			anonymity: group(match, "anonymity"),
+		})
+	}
+	return records, nil
+}
+
+// extractByJSON 🧾 使用路径表达式从JSON中提取
+func extractByJSON(rule *resource.ExtractorConfig, content string) ([]extractedRecord, error) {
+	var document any
+	if err := json.Unmarshal([]byte(content), &document); err != nil {
+		return nil, err
+	}
+
+	items, err := resolveJSONPath(document, rule.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	field := func(item any, path string) (string, error) {
+		if path == "" {
+			return "", nil
+		}
+		values, err := resolveJSONPath(item, path)
+		if err != nil || len(values) == 0 {
+			return "", err
+		}
+		return jsonScalar(values[0]), nil
+	}
+
+	var records []extractedRecord
+	for _, item := range items {
+		var record extractedRecord
+		if record.ip, err = field(item, rule.IP); err != nil {
+			return nil, err
+		}
+		if record.port, err = field(item, rule.Port); err != nil {
+			return nil, err
+		}
+		if record.protocol, err = field(item, rule.Protocol); err != nil {
+			return nil, err
+		}
+		if record.country, err = field(item, rule.Country); err != nil {
+			return nil, err
+		}
+		if record.anonymity, err = field(item, rule.Anonymity); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// resolveJSONPath 🧭 解析点号分隔的路径表达式
+//
+// 支持可选的 "$" 根前缀、字段名、[N] 下标和 [*] / * 通配
+//
+// 参数:
+//   - document: 已解码的JSON值
+//   - path: 路径表达式, 为空时返回根节点(根节点为数组时返回全部元素)
+//
+// 返回值:
+//   - []any: 路径命中的全部值
+//   - error: 路径格式错误时返回错误
+func resolveJSONPath(document any, path string) ([]any, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	current := []any{document}
+	if path == "" {
+		if array, ok := document.([]any); ok {
+			return array, nil
+		}
+		return current, nil
+	}
+
+	for _, segment := range strings.Split(path, ".") {
+		matches := jsonPathSegment.FindStringSubmatch(segment)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid json path segment %q", segment)
+		}
+		name, indexes := matches[1], matches[2]
+
+		var next []any
+		for _, value := range current {
+			switch {
+			case name == "*":
+				next = append(next, jsonChildren(value)...)
+			case name != "":
+				if object, ok := value.(map[string]any); ok {
+					if child, ok := object[name]; ok {
+						next = append(next, child)
+					}
+				}
+			default:
+				next = append(next, value)
+			}
+		}
+
+		for _, index := range strings.Split(strings.Trim(indexes, "[]"), "][") {
+			if index == "" {
+				continue
+			}
+			var indexed []any
+			for _, value := range next {
+				array, ok := value.([]any)
+				if !ok {
+					continue
+				}
+				if index == "*" {
+					indexed = append(indexed, array...)
+					continue
+				}
+				position, _ := strconv.Atoi(index)
+				if position < len(array) {
+					indexed = append(indexed, array[position])
+				}
+			}
+			next = indexed
+		}
+		current = next
+	}
+
+	return current, nil
+}
+
+// jsonChildren 返回对象或数组的全部子节点
+func jsonChildren(value any) []any {
+	switch typed := value.(type) {
+	case []any:
+		return typed
+	case map[string]any:
+		children := make([]any, 0, len(typed))
+		for _, child := range typed {
+			children = append(children, child)
+		}
+		return children
+	}
+	return nil
+}
+
+// jsonScalar 将JSON标量转换为字符串, 数字不使用科学计数法
+func jsonScalar(value any) string {
+	switch typed := value.(type) {
+	case string:
+		return strings.TrimSpace(typed)
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// normalizeRecord 校验记录中的主机与端口, 允许主机字段本身带有端口
+//
+// 主机可以是 IPv4、IPv6 或域名, 结果由 normalizeAddress 规范化
+func normalizeRecord(record extractedRecord) (string, bool) {
+	ip, port := strings.TrimSpace(record.ip), record.port
+	if host, embeddedPort, ok := splitAddress(ip); ok && port == "" {
+		ip, port = host, embeddedPort
+	}
+
+	return normalizeAddress(ip, portPattern.FindString(port))
+}
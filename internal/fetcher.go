@@ -0,0 +1,280 @@
+// Author       :loyd
+// Date         :2025-03-18 20:05:33
+// LastEditors  :loyd
+// LastEditTime :2025-03-18 21:46:12
+// Description  :按平台配置请求代理源页面
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"zol9527/proxies/pkg/logger"
+	"zol9527/proxies/pkg/resource"
+
+	"github.com/duke-git/lancet/v2/maputil"
+	"github.com/duke-git/lancet/v2/netutil"
+	"github.com/duke-git/lancet/v2/strutil"
+)
+
+const (
+	// defaultFetchTimeout 平台未配置 timeout 时的单次请求超时
+	defaultFetchTimeout = 15 * time.Second
+	// defaultFetchWorkers 未配置 fetch.workers 时同时处理的URL组数量
+	defaultFetchWorkers = 8
+	// defaultFetchPerHost 未配置 fetch.perHost 时同一主机的最大并发请求数
+	defaultFetchPerHost = 2
+	// defaultFetchRetries 平台与 fetch.retries 均未配置时的重试次数
+	defaultFetchRetries = 2
+	// defaultUserAgent 平台未配置 User-Agent 时使用的浏览器标识
+	defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36"
+)
+
+// fetchPage 📥 请求单个URL并解析出其中的IP地址
+//
+// 网络错误、超时、429 与 5xx 按指数退避加抖动重试(优先遵循 Retry-After),
+// 非 2xx 响应与反爬拦截页面视为失败, 不会当作代理列表解析;
+// 开启 proxy 的平台被拦截后改用已验证的代理中转重试
+//
+// 参数:
+//   - ctx: 控制重试等待与请求的上下文
+//   - session: 本轮抓取共享的中转代理、缓存与录制目录
+//   - platform: URL所属的平台配置
+//   - rawURL: 请求地址
+//   - retries: 最大重试次数
+//
+// 返回值:
+//   - []Candidate: 解析到的候选代理, 已标记来源并补全平台级声明
+//   - int: 实际请求次数
+//   - error: 最后一次失败的分类错误(*fetchError)
+func fetchPage(ctx context.Context, session *fetchSession, platform resource.PlatformConfig, rawURL string, retries int) ([]Candidate, int, error) {
+	candidates, attempts, err := fetchWithRetry(ctx, session, platform, rawURL, retries, nil)
+	if !isBlocked(err) || !platform.Proxy {
+		return candidates, attempts, err
+	}
+
+	for _, relay := range pickRelays(session.relays, rawURL, relayAttempts) {
+		logger.GetLogger().Info(fmt.Sprintf("🔀 来源被拦截, 通过代理 %s 重试 [%s]", relay.Host, rawURL))
+		relayed, relayAttempts, relayErr := fetchWithRetry(ctx, session, platform, rawURL, 0, relay)
+		attempts += relayAttempts
+		if relayErr == nil {
+			return relayed, attempts, nil
+		}
+	}
+	return nil, attempts, err
+}
+
+// fetchWithRetry 🔁 请求URL并解析, 可重试的错误按退避策略重试
+//
+// 直接请求时有缓存的 GET 请求会带上 If-None-Match/If-Modified-Since, 收到 304 时直接复用缓存的候选代理
+//
+// 参数:
+//   - ctx: 控制重试等待与请求的上下文
+//   - session: 本轮抓取共享的缓存与录制目录
+//   - platform: URL所属的平台配置
+//   - rawURL: 请求地址
+//   - retries: 最大重试次数
+//   - relay: 中转代理, 为 nil 时直接请求
+//
+// 返回值:
+//   - []Candidate: 解析到的候选代理
+//   - int: 实际请求次数
+//   - error: 最后一次失败的分类错误(*fetchError)
+func fetchWithRetry(ctx context.Context, session *fetchSession, platform resource.PlatformConfig, rawURL string, retries int, relay *url.URL) ([]Candidate, int, error) {
+	logger := logger.GetLogger()
+
+	var cache *sourceCache
+	var cached *cacheEntry
+	if relay == nil {
+		cache = session.cache
+	}
+	if strings.EqualFold(platform.Method, http.MethodGet) {
+		cached = cache.lookup(platform, rawURL)
+	}
+
+	attempts := 0
+	for {
+		attempts++
+		page, err := fetchContent(ctx, platform, rawURL, relay, cached, session.fixtures)
+		if err == nil && page.status == http.StatusNotModified {
+			logger.Info(fmt.Sprintf("♻️ 来源未变化, 复用缓存的 %d 个IP地址 [%s]", len(cached.Candidates), rawURL))
+			return append([]Candidate(nil), cached.Candidates...), attempts, nil
+		}
+		if err == nil {
+			// 反混淆后按平台规则或启发式解析页面中的代理
+			content := applyDecoders(platform, page.content)
+			candidates := ExtractProxies(platform, content)
+			if len(candidates) == 0 {
+				// 解析不到代理时再用较弱的特征区分拦截页面与空列表
+				if blocked := detectBlocked(page.status, page.header, page.content, false); blocked != nil {
+					return nil, attempts, blocked
+				}
+			}
+
+			hints := platformHints(platform, rawURL)
+			for i := range candidates {
+				candidates[i].Source = platform.Name
+				candidates[i].Hints = candidates[i].Hints.merge(hints)
+			}
+			if len(candidates) > 0 {
+				cache.store(platform, rawURL, page.header, candidates)
+			}
+			return candidates, attempts, nil
+		}
+
+		fetchErr := classifyFetchError(err)
+		if attempts > retries || !fetchErr.retryable() {
+			return nil, attempts, fetchErr
+		}
+
+		delay := backoffDelay(attempts, fetchErr)
+		logger.Debug(fmt.Sprintf("🔁 %s 后第 %d 次重试 [%s]: %v", delay.Round(time.Millisecond), attempts, rawURL, fetchErr))
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, attempts, fetchErr
+		}
+	}
+}
+
+// fetchedPage 一次成功请求的响应
+type fetchedPage struct {
+	status  int
+	header  http.Header
+	content string
+}
+
+// fetchContent 🌐 按平台配置发送一次请求并返回响应内容
+//
+// 参数:
+//   - ctx: 请求上下文
+//   - platform: URL所属的平台配置
+//   - rawURL: 请求地址
+//   - relay: 中转代理, 为 nil 时直接请求
+//   - cached: 上次的缓存, 不为 nil 时发送条件请求
+//   - fixtures: 响应录制/回放目录, 为 nil 时直接访问网络
+//
+// 返回值:
+//   - *fetchedPage: 解压并转码为 UTF-8 的响应, 来源未变化时只有 304 状态码
+//   - error: 请求失败、响应非 2xx 或为人机校验页面时返回错误
+func fetchContent(ctx context.Context, platform resource.PlatformConfig, rawURL string, relay *url.URL, cached *cacheEntry, fixtures *fixtureStore) (*fetchedPage, error) {
+	request := &netutil.HttpRequest{
+		RawURL:  rawURL,
+		Method:  strings.ToUpper(platform.Method),
+		Headers: buildHeaders(platform, rawURL),
+	}
+	cached.setConditionalHeaders(request.Headers)
+	if platform.Body != "" {
+		request.Body = []byte(platform.Body)
+	}
+
+	timeout := defaultFetchTimeout
+	if platform.Timeout > 0 {
+		timeout = time.Duration(platform.Timeout) * time.Second
+	}
+
+	client := netutil.NewHttpClient()
+	client.Client.Timeout = timeout
+	client.Context = ctx
+	if transport, ok := client.Client.Transport.(*http.Transport); ok && relay != nil {
+		transport.Proxy = http.ProxyURL(relay)
+	}
+	client.Client.Transport = fixtures.wrap(client.Client.Transport)
+	resp, err := client.SendRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// 转化 http response 为 UTF-8 字符串
+	byteContent, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应内容失败: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return &fetchedPage{status: resp.StatusCode, header: resp.Header}, nil
+	}
+
+	// 非 2xx 响应不作为代理列表解析, 拦截页面单独归类
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if blocked := detectBlocked(resp.StatusCode, resp.Header, string(byteContent), false); blocked != nil {
+			return nil, blocked
+		}
+		return nil, statusError(resp)
+	}
+
+	// 压缩的列表文件先解压再转码
+	byteContent, err = decompressBody(byteContent)
+	if err != nil {
+		return nil, err
+	}
+
+	content, charsetName, err := decodeContent(byteContent, resp.Header.Get("Content-Type"), platform.Charset)
+	if err != nil {
+		return nil, err
+	}
+	if charsetName != "utf-8" {
+		logger.GetLogger().Debug(fmt.Sprintf("🈶 按 %s 字符集解码 [%s]", charsetName, rawURL))
+	}
+	if blocked := detectBlocked(resp.StatusCode, resp.Header, content, true); blocked != nil {
+		return nil, blocked
+	}
+
+	return &fetchedPage{status: resp.StatusCode, header: resp.Header, content: content}, nil
+}
+
+// buildHeaders 🧾 合并平台自定义请求头、Cookie 与浏览器默认请求头
+//
+// 参数:
+//   - platform: 平台配置
+//   - rawURL: 请求地址, 用于生成默认 Referer
+//
+// 返回值:
+//   - http.Header: 最终发送的请求头
+func buildHeaders(platform resource.PlatformConfig, rawURL string) http.Header {
+	headers := http.Header{}
+	for key, value := range platform.Headers {
+		headers.Set(key, value)
+	}
+
+	if headers.Get("User-Agent") == "" {
+		headers.Set("User-Agent", defaultUserAgent)
+	}
+	if headers.Get("Accept-Language") == "" {
+		headers.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+	}
+	if headers.Get("Referer") == "" {
+		if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+			headers.Set("Referer", parsed.Scheme+"://"+parsed.Host+"/")
+		}
+	}
+
+	// 请求体未声明类型时根据内容推断
+	if platform.Body != "" && headers.Get("Content-Type") == "" {
+		body := strings.TrimSpace(platform.Body)
+		if strings.HasPrefix(body, "{") || strings.HasPrefix(body, "[") {
+			headers.Set("Content-Type", "application/json")
+		} else {
+			headers.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+
+	if len(platform.Cookies) > 0 {
+		var cookies []string
+		for _, name := range maputil.Keys(platform.Cookies) {
+			cookies = append(cookies, (&http.Cookie{Name: name, Value: platform.Cookies[name]}).String())
+		}
+		sort.Strings(cookies)
+		if existing := headers.Get("Cookie"); !strutil.IsBlank(existing) {
+			cookies = append([]string{existing}, cookies...)
+		}
+		headers.Set("Cookie", strings.Join(cookies, "; "))
+	}
+
+	return headers
+}
@@ -0,0 +1,175 @@
+// Author       :loyd
+// Date         :2025-04-07 20:03:51
+// LastEditors  :loyd
+// LastEditTime :2025-04-07 22:45:12
+// Description  :代理源请求错误的分类、重试判断与退避
+
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 请求错误分类
+const (
+	errorDNS        = "dns"
+	errorTimeout    = "timeout"
+	errorTLS        = "tls"
+	errorHTTPStatus = "http-status"
+	errorBlocked    = "blocked"
+	errorNetwork    = "network"
+	errorFixture    = "fixture"
+)
+
+const (
+	// backoffBase 首次重试前的基础等待时间, 之后每次翻倍
+	backoffBase = time.Second
+	// backoffMax 单次退避等待的上限
+	backoffMax = 30 * time.Second
+	// retryAfterMax 服务端 Retry-After 的采纳上限, 超过时视为不可重试
+	retryAfterMax = 2 * time.Minute
+)
+
+// fetchError 分类后的代理源请求错误
+type fetchError struct {
+	// Category 错误分类: dns、timeout、tls、http-status、blocked、network, 回放时缺少响应文件为 fixture
+	Category string
+	// Status HTTP 状态码, 未收到响应时为 0
+	Status int
+	// RetryAfter 服务端要求的重试等待时间
+	RetryAfter time.Duration
+	// Err 原始错误
+	Err error
+}
+
+// Error 实现 error 接口
+func (e *fetchError) Error() string {
+	return fmt.Sprintf("[%s] %v", e.Category, e.Err)
+}
+
+// Unwrap 返回原始错误
+func (e *fetchError) Unwrap() error {
+	return e.Err
+}
+
+// retryable 判断错误是否值得重试: 网络错误、超时、429 与 5xx, Retry-After 过长时放弃
+func (e *fetchError) retryable() bool {
+	if e.RetryAfter > retryAfterMax {
+		return false
+	}
+	switch e.Category {
+	case errorTimeout, errorNetwork:
+		return true
+	case errorDNS:
+		var dnsErr *net.DNSError
+		return !errors.As(e.Err, &dnsErr) || !dnsErr.IsNotFound
+	case errorHTTPStatus:
+		return e.Status == http.StatusTooManyRequests || e.Status >= 500
+	}
+	return false
+}
+
+// classifyFetchError 🏷️ 将请求错误归类
+//
+// 参数:
+//   - err: 请求过程中返回的错误
+//
+// 返回值:
+//   - *fetchError: 分类后的错误, err 已经分类时原样返回
+func classifyFetchError(err error) *fetchError {
+	var classified *fetchError
+	if errors.As(err, &classified) {
+		return classified
+	}
+
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+
+	category := errorNetwork
+	switch {
+	case errors.As(err, &dnsErr):
+		category = errorDNS
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		category = errorTimeout
+	case errors.As(err, &recordErr), errors.As(err, &certErr), errors.As(err, &alertErr),
+		errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr), strings.Contains(err.Error(), "tls:"):
+		category = errorTLS
+	}
+	return &fetchError{Category: category, Err: err}
+}
+
+// statusError 根据非 2xx 响应生成错误, 429 与 503 会读取 Retry-After
+func statusError(resp *http.Response) *fetchError {
+	return &fetchError{
+		Category:   errorHTTPStatus,
+		Status:     resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Err:        fmt.Errorf("unexpected status %s", resp.Status),
+	}
+}
+
+// parseRetryAfter 解析秒数或 HTTP 日期形式的 Retry-After
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// backoffDelay ⏱️ 计算第 attempt 次重试前的等待时间
+//
+// 默认按指数退避并加入随机抖动(等待时间在 [d/2, d) 之间), 服务端给出 Retry-After 时以其为准
+//
+// 参数:
+//   - attempt: 即将进行的重试序号, 从 1 开始
+//   - err: 上一次请求的错误
+//
+// 返回值:
+//   - time.Duration: 等待时间
+func backoffDelay(attempt int, err *fetchError) time.Duration {
+	if err.RetryAfter > 0 {
+		return err.RetryAfter
+	}
+
+	delay := backoffBase << (attempt - 1)
+	if delay > backoffMax || delay <= 0 {
+		delay = backoffMax
+	}
+	return delay/2 + rand.N(delay/2)
+}
+
+// sleepContext 等待指定时间, ctx 被取消时提前返回其错误
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
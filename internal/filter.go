@@ -0,0 +1,189 @@
+// Author       :loyd
+// Date         :2025-04-03 20:31:47
+// LastEditors  :loyd
+// LastEditTime :2025-04-03 23:02:36
+// Description  :按网段、端口和 ASN 过滤代理地址
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"zol9527/proxies/pkg/geo"
+	"zol9527/proxies/pkg/logger"
+	"zol9527/proxies/pkg/resource"
+)
+
+// ProxyFilter 按 [filter] 配置判断代理能否使用, 拒绝名单优先于允许名单
+type ProxyFilter struct {
+	allowCIDRs []netip.Prefix
+	denyCIDRs  []netip.Prefix
+	allowPorts map[int]bool
+	denyPorts  map[int]bool
+	allowASNs  map[uint]bool
+	denyASNs   map[uint]bool
+	asn        *geo.Reader
+}
+
+// NewProxyFilter 🚧 根据配置创建过滤器, ASN 名单使用 geo.asnDatabase 的读取器
+//
+// 参数:
+//   - config: 过滤配置
+//   - asn: geo.asnDatabase 的读取器, 由调用方负责关闭, 未配置 ASN 名单时可以为 nil
+//
+// 返回值:
+//   - *ProxyFilter: 过滤器
+//   - error: 网段格式无效或配置了 ASN 名单却没有 ASN 数据库时返回错误
+func NewProxyFilter(config resource.FilterConfig, asn *geo.Reader) (*ProxyFilter, error) {
+	filter := &ProxyFilter{
+		allowPorts: intSet(config.AllowPorts),
+		denyPorts:  intSet(config.DenyPorts),
+		allowASNs:  make(map[uint]bool, len(config.AllowASNs)),
+		denyASNs:   make(map[uint]bool, len(config.DenyASNs)),
+	}
+
+	for _, cidr := range config.AllowCIDRs {
+		prefix, err := resource.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("filter: invalid cidr %q: %w", cidr, err)
+		}
+		filter.allowCIDRs = append(filter.allowCIDRs, prefix)
+	}
+	for _, cidr := range config.DenyCIDRs {
+		prefix, err := resource.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("filter: invalid cidr %q: %w", cidr, err)
+		}
+		filter.denyCIDRs = append(filter.denyCIDRs, prefix)
+	}
+
+	for _, number := range config.AllowASNs {
+		filter.allowASNs[uint(number)] = true
+	}
+	for _, number := range config.DenyASNs {
+		filter.denyASNs[uint(number)] = true
+	}
+	if len(filter.allowASNs) > 0 || len(filter.denyASNs) > 0 {
+		if asn == nil {
+			return nil, errors.New("filter: allowAsns and denyAsns require geo.asnDatabase")
+		}
+		filter.asn = asn
+	}
+
+	return filter, nil
+}
+
+// Allow 🚦 判断代理地址是否允许使用
+//
+// 域名地址使用解析阶段得到的IP并要求全部通过, 过滤时不再发起解析,
+// 配置了网段或 ASN 规则而域名没有解析结果时拒绝
+//
+// 参数:
+//   - address: 规范化后的代理地址
+//   - resolved: 域名地址已解析到的IP, IP 地址可为空
+//
+// 返回值:
+//   - bool: 是否允许
+//   - string: 拒绝原因, 允许时为空
+func (f *ProxyFilter) Allow(address string, resolved []netip.Addr) (bool, string) {
+	host, portText, ok := splitAddress(address)
+	if !ok {
+		return false, "invalid"
+	}
+	port, _ := strconv.Atoi(portText)
+	if f.denyPorts[port] {
+		return false, "port"
+	}
+	if len(f.allowPorts) > 0 && !f.allowPorts[port] {
+		return false, "port"
+	}
+
+	if len(f.allowCIDRs) == 0 && len(f.denyCIDRs) == 0 && f.asn == nil {
+		return true, ""
+	}
+
+	addrs := resolveFilterAddrs(host, resolved)
+	if len(addrs) == 0 {
+		return false, "unresolved"
+	}
+	for _, addr := range addrs {
+		if allowed, reason := f.allowAddr(addr); !allowed {
+			return false, reason
+		}
+	}
+	return true, ""
+}
+
+// allowAddr 按网段和 ASN 规则判断单个IP
+func (f *ProxyFilter) allowAddr(addr netip.Addr) (bool, string) {
+	if prefixesContain(f.denyCIDRs, addr) {
+		return false, "cidr"
+	}
+	if len(f.allowCIDRs) > 0 && !prefixesContain(f.allowCIDRs, addr) {
+		return false, "cidr"
+	}
+
+	if f.asn != nil {
+		record, err := f.asn.ASN(addr)
+		if err != nil {
+			return false, "asn"
+		}
+		if f.denyASNs[record.Number] {
+			return false, "asn"
+		}
+		if len(f.allowASNs) > 0 && !f.allowASNs[record.Number] {
+			return false, "asn"
+		}
+	}
+	return true, ""
+}
+
+// resolveFilterAddrs 返回过滤时使用的IP列表, 域名使用已解析的IP
+func resolveFilterAddrs(host string, resolved []netip.Addr) []netip.Addr {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr.Unmap()}
+	}
+	return resolved
+}
+
+// prefixesContain 判断IP是否落在任一网段内
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// intSet 将整数列表转换为集合
+func intSet(values []int) map[int]bool {
+	set := make(map[int]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// logRejected 按原因输出被过滤的数量
+func logRejected(kind string, rejected map[string]int) {
+	if len(rejected) == 0 {
+		return
+	}
+	reasons := make([]string, 0, len(rejected))
+	for reason := range rejected {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	total := 0
+	details := ""
+	for _, reason := range reasons {
+		total += rejected[reason]
+		details += fmt.Sprintf(" %s=%d", reason, rejected[reason])
+	}
+	logger.GetLogger().Info(fmt.Sprintf("🚧 名单过滤丢弃 %d 个%s:%s", total, kind, details))
+}
@@ -0,0 +1,225 @@
+// Author       :loyd
+// Date         :2025-04-10 20:12:37
+// LastEditors  :loyd
+// LastEditTime :2025-04-10 22:48:05
+// Description  :录制与回放代理源的原始响应, 用于离线复现解析问题
+
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"zol9527/proxies/pkg/logger"
+	"zol9527/proxies/pkg/resource"
+
+	"github.com/duke-git/lancet/v2/cryptor"
+)
+
+// 来源响应的录制/回放模式
+const (
+	fixtureRecord = "record"
+	fixtureReplay = "replay"
+)
+
+// defaultFixtureDir 未配置 fixture.dir 时的响应文件目录
+const defaultFixtureDir = "fixtures"
+
+// fixture 一次来源请求的原始响应
+type fixture struct {
+	URL        string      `json:"url"`
+	Method     string      `json:"method"`
+	Status     int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+	Encoding   string      `json:"encoding,omitempty"`
+	RecordedAt time.Time   `json:"recordedAt"`
+}
+
+// fixtureStore 响应文件目录, 一个请求对应一个文件
+type fixtureStore struct {
+	mode string
+	dir  string
+}
+
+// newFixtureStore 📼 根据配置创建响应录制/回放目录, 未开启时返回 nil
+//
+// 参数:
+//   - config: 录制/回放配置
+//
+// 返回值:
+//   - *fixtureStore: 响应文件目录
+//   - error: 录制目录无法创建时返回错误
+func newFixtureStore(config resource.FixtureConfig) (*fixtureStore, error) {
+	mode := strings.ToLower(config.Mode)
+	if mode == "" {
+		return nil, nil
+	}
+
+	store := &fixtureStore{mode: mode, dir: config.Dir}
+	if store.dir == "" {
+		store.dir = defaultFixtureDir
+	}
+	if mode == fixtureRecord {
+		if err := os.MkdirAll(store.dir, 0o755); err != nil {
+			return nil, fmt.Errorf("create fixture dir: %w", err)
+		}
+	}
+	return store, nil
+}
+
+// wrap 为请求包装录制或回放的 RoundTripper, 未开启时原样返回
+func (s *fixtureStore) wrap(next http.RoundTripper) http.RoundTripper {
+	if s == nil {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &fixtureTransport{store: s, next: next}
+}
+
+// path 返回请求对应的文件路径, 由请求方法、地址和请求体的摘要命名
+func (s *fixtureStore) path(method, rawURL string, body []byte) string {
+	key := strings.ToUpper(method) + " " + rawURL
+	if len(body) > 0 {
+		key += "\n" + string(body)
+	}
+	return filepath.Join(s.dir, cryptor.Sha1(key)+".json")
+}
+
+// load 📂 按请求方法、地址和请求体读取录制的响应, 供回放与离线测试按URL查找
+//
+// 参数:
+//   - method: 请求方法
+//   - rawURL: 请求地址
+//   - body: 请求体, 没有时为 nil
+//
+// 返回值:
+//   - *fixture: 录制的响应
+//   - error: 没有录制该请求或文件格式错误时返回错误
+func (s *fixtureStore) load(method, rawURL string, body []byte) (*fixture, error) {
+	return readFixture(s.path(method, rawURL, body))
+}
+
+// readFixture 📂 读取响应文件
+//
+// 参数:
+//   - path: 文件路径
+//
+// 返回值:
+//   - *fixture: 录制的响应
+//   - error: 文件不存在或格式错误时返回错误
+func readFixture(path string) (*fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var recorded fixture
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return nil, fmt.Errorf("parse fixture %s: %w", path, err)
+	}
+	return &recorded, nil
+}
+
+// body 返回解码后的原始响应体
+func (f *fixture) body() ([]byte, error) {
+	if f.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(f.Body)
+	}
+	return []byte(f.Body), nil
+}
+
+// fixtureTransport 录制或回放来源响应的 RoundTripper
+type fixtureTransport struct {
+	store *fixtureStore
+	next  http.RoundTripper
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	if t.store.mode == fixtureReplay {
+		return t.replay(req, reqBody)
+	}
+	return t.record(req, t.store.path(req.Method, req.URL.String(), reqBody))
+}
+
+// replay 从响应文件构造响应, 不访问网络
+func (t *fixtureTransport) replay(req *http.Request, reqBody []byte) (*http.Response, error) {
+	recorded, err := t.store.load(req.Method, req.URL.String(), reqBody)
+	if err != nil {
+		return nil, &fetchError{Category: errorFixture, Err: fmt.Errorf("no fixture for %s %s: %w", req.Method, req.URL, err)}
+	}
+	body, err := recorded.body()
+	if err != nil {
+		return nil, &fetchError{Category: errorFixture, Err: fmt.Errorf("decode fixture for %s %s: %w", req.Method, req.URL, err)}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// record 发送请求并把原始响应写入文件, 写入失败不影响本次抓取
+func (t *fixtureTransport) record(req *http.Request, path string) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	recorded := fixture{
+		URL:        req.URL.String(),
+		Method:     req.Method,
+		Status:     resp.StatusCode,
+		Header:     resp.Header,
+		Body:       string(body),
+		RecordedAt: time.Now(),
+	}
+	// 压缩包等二进制内容按 base64 保存
+	if !utf8.Valid(body) {
+		recorded.Body = base64.StdEncoding.EncodeToString(body)
+		recorded.Encoding = "base64"
+	}
+
+	data, err := json.MarshalIndent(recorded, "", "  ")
+	if err == nil {
+		err = os.WriteFile(path, data, 0o644)
+	}
+	if err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("⚠️ 保存来源响应失败 [%s]: %v", req.URL, err))
+	} else {
+		logger.GetLogger().Debug(fmt.Sprintf("📼 已录制 %s -> %s", req.URL, path))
+	}
+	return resp, nil
+}
@@ -0,0 +1,79 @@
+// Author       :loyd
+// Date         :2025-04-13 22:10:35
+// LastEditors  :loyd
+// LastEditTime :2025-04-14 21:36:52
+// Description  :基于录制响应的解析回归测试, 响应文件保存在 testdata/fixtures 中
+
+package internal
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"zol9527/proxies/pkg/resource"
+)
+
+// fixtureDir 回归测试使用的录制文件目录, 文件需由 fixture.mode=record 录制且不做修改
+const fixtureDir = "testdata/fixtures"
+
+// TestReplayRecordings 回放录制的真实来源响应, 按 config/proxy-sources.toml 中对应平台的规则解析,
+// 校验每个页面都能解析出格式有效的代理
+func TestReplayRecordings(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join(fixtureDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Skip("no recorded fixtures, record them with: go run ./cmd/main.go --set fixture.mode=record --set fixture.dir=internal/testdata/fixtures")
+	}
+
+	config, err := resource.LoadConfig(filepath.Join("..", "config", "proxy-sources.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	platforms := make(map[string]resource.PlatformConfig)
+	for _, platform := range config.Platforms {
+		groups, err := platform.URLGroups()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, group := range groups {
+			for _, rawURL := range group {
+				platforms[rawURL] = platform
+			}
+		}
+	}
+
+	store, err := newFixtureStore(resource.FixtureConfig{Mode: fixtureReplay, Dir: fixtureDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		recorded, err := readFixture(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(recorded.URL, func(t *testing.T) {
+			platform, ok := platforms[recorded.URL]
+			if !ok {
+				t.Skipf("%s is not a source in config/proxy-sources.toml", filepath.Base(path))
+			}
+
+			// 经过回放的 RoundTripper 读取, 与抓取时的转码、解压和拦截识别流程一致
+			page, err := fetchContent(context.Background(), platform, recorded.URL, nil, nil, store)
+			if err != nil {
+				t.Skipf("recorded response is not a usable page: %v", err)
+			}
+
+			candidates := ExtractProxies(platform, applyDecoders(platform, page.content))
+			if len(candidates) == 0 {
+				t.Fatalf("platform %s parsed no proxies from %s", platform.Name, filepath.Base(path))
+			}
+			for _, candidate := range candidates {
+				if _, reason := sanitizeCandidate(candidate); reason == addressInvalid {
+					t.Errorf("platform %s parsed invalid address %q", platform.Name, candidate.Address)
+				}
+			}
+		})
+	}
+}
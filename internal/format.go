@@ -0,0 +1,355 @@
+// Author       :loyd
+// Date         :2025-03-28 20:33:19
+// LastEditors  :loyd
+// LastEditTime :2025-03-28 23:05:47
+// Description  :纯文本、CSV、base64 及压缩格式的代理列表解析
+
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"zol9527/proxies/pkg/logger"
+)
+
+// 代理源内容格式
+const (
+	formatAuto   = "auto"
+	formatHTML   = "html"
+	formatText   = "text"
+	formatCSV    = "csv"
+	formatBase64 = "base64"
+)
+
+var (
+	// textLinePattern 匹配 "host:port" 或 "scheme://[user:pass@]host:port" 开头的行, host 可以是 IPv4、[IPv6] 或域名
+	textLinePattern = regexp.MustCompile(`^(?:([A-Za-z0-9]+)://)?(?:([^@\s/]+)@)?((?:\d{1,3}\.){3}\d{1,3}|\[[0-9A-Fa-f:.]+\]|[A-Za-z0-9](?:[A-Za-z0-9.-]*[A-Za-z0-9])?):(\d{1,5})\b`)
+	// base64BlobPattern 匹配去除空白后的 base64 文本
+	base64BlobPattern = regexp.MustCompile(`^[A-Za-z0-9+/_-]+={0,2}$`)
+)
+
+const (
+	// maxDecompressedSize 解压后内容的大小上限, 防止压缩炸弹耗尽内存
+	maxDecompressedSize = 32 << 20
+	// maxZipEntries zip 中允许的文件数量上限
+	maxZipEntries = 64
+)
+
+// csvColumnAliases 各字段在 CSV 表头中的常见名称
+var csvColumnAliases = map[string][]string{
+	"ip":        {"ip", "host", "address", "addr", "server", "proxy"},
+	"port":      {"port"},
+	"protocol":  {"protocol", "type", "scheme", "protocols"},
+	"country":   {"country", "country_code", "countrycode", "location"},
+	"anonymity": {"anonymity", "anonymity_level", "level"},
+	"username":  {"username", "user", "login"},
+	"password":  {"password", "pass"},
+}
+
+// decompressBody 📦 识别并解压 gzip / zip 格式的响应内容
+//
+// 通过文件头魔数识别, zip 中的全部文件内容按换行拼接,
+// 解压后的总大小不超过 maxDecompressedSize, zip 中的文件不超过 maxZipEntries 个
+//
+// 参数:
+//   - body: 原始响应内容
+//
+// 返回值:
+//   - []byte: 解压后的内容, 非压缩内容原样返回
+//   - error: 压缩内容损坏或超出大小、文件数量上限时返回错误
+func decompressBody(body []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(body, []byte{0x1f, 0x8b}):
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip content: %w", err)
+		}
+		defer reader.Close()
+		var decompressed bytes.Buffer
+		if err := copyLimited(&decompressed, reader, maxDecompressedSize); err != nil {
+			return nil, fmt.Errorf("read gzip content: %w", err)
+		}
+		return decompressed.Bytes(), nil
+
+	case bytes.HasPrefix(body, []byte("PK\x03\x04")):
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip content: %w", err)
+		}
+		if len(archive.File) > maxZipEntries {
+			return nil, fmt.Errorf("zip contains %d files, more than %d", len(archive.File), maxZipEntries)
+		}
+		var merged bytes.Buffer
+		for _, file := range archive.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			reader, err := file.Open()
+			if err != nil {
+				return nil, fmt.Errorf("open %s in zip: %w", file.Name, err)
+			}
+			err = copyLimited(&merged, reader, maxDecompressedSize-int64(merged.Len()))
+			reader.Close()
+			if err != nil {
+				return nil, fmt.Errorf("read %s in zip: %w", file.Name, err)
+			}
+			merged.WriteByte('\n')
+		}
+		return merged.Bytes(), nil
+	}
+
+	return body, nil
+}
+
+// copyLimited 最多复制 limit 字节, 内容超出上限时返回错误
+func copyLimited(dst io.Writer, src io.Reader, limit int64) error {
+	written, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err != nil {
+		return err
+	}
+	if written > limit {
+		return fmt.Errorf("decompressed content exceeds %d bytes", int64(maxDecompressedSize))
+	}
+	return nil
+}
+
+// detectFormat 🔎 根据内容特征推断代理列表格式
+//
+// 参数:
+//   - content: 解压、转码后的内容
+//
+// 返回值:
+//   - string: text、csv、base64、clash 或 html
+func detectFormat(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" || strings.HasPrefix(trimmed, "<") {
+		return formatHTML
+	}
+
+	if _, ok := decodeBase64Blob(trimmed); ok {
+		return formatBase64
+	}
+	if strings.HasPrefix(trimmed, "proxies:") || strings.Contains(trimmed, "\nproxies:") {
+		return formatClash
+	}
+
+	lines := nonEmptyLines(trimmed)
+	if len(lines) > 1 && strings.Contains(lines[0], ",") && csvHeaderColumns(csvSplit(lines[0]))["ip"] >= 0 {
+		return formatCSV
+	}
+
+	matched := 0
+	for _, line := range lines {
+		if textLinePattern.MatchString(line) {
+			matched++
+		}
+	}
+	if matched > 0 && matched*2 >= len(lines) {
+		return formatText
+	}
+
+	return formatHTML
+}
+
+// parseByFormat 🗂️ 按格式解析代理列表, html 及无法识别的内容交给 ParseURLs 启发式解析
+//
+// 参数:
+//   - format: 平台配置的格式, 为空或 auto 时自动识别
+//   - content: 页面内容
+//
+// 返回值:
+//   - []Candidate: 候选代理
+func parseByFormat(format, content string) []Candidate {
+	if format == "" || format == formatAuto {
+		format = detectFormat(content)
+		logger.GetLogger().Debug(fmt.Sprintf("🔎 自动识别内容格式: %s", format))
+	}
+
+	switch format {
+	case formatText:
+		return parseTextList(content)
+	case formatCSV:
+		return parseCSVList(content)
+	case formatClash:
+		return parseClashList(content)
+	case formatBase64:
+		decoded, ok := decodeBase64Blob(strings.TrimSpace(content))
+		if !ok {
+			logger.GetLogger().Warn("⚠️ base64 内容解码失败")
+			return nil
+		}
+		return parseByFormat(formatAuto, decoded)
+	}
+	return ParseURLs(content)
+}
+
+// parseTextList 📃 解析每行一个代理的纯文本列表
+//
+// 支持 "host:port" 与 "scheme://[user:pass@]host:port", host 可以是 IPv4、[IPv6] 或域名,
+// 协议前缀作为协议声明, 认证信息随候选代理保留, 以 # 开头的行视为注释
+//
+// 参数:
+//   - content: 文本内容
+//
+// 返回值:
+//   - []Candidate: 候选代理
+func parseTextList(content string) []Candidate {
+	var candidates []Candidate
+	for _, line := range nonEmptyLines(content) {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		matches := textLinePattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		record := extractedRecord{ip: matches[3], port: matches[4], protocol: matches[1]}
+		if address, ok := normalizeRecord(record); ok {
+			candidate := Candidate{Address: address, Hints: newClaims(record.protocol, "", "")}
+			if matches[2] != "" {
+				if userinfo, err := url.Parse("//" + matches[2] + "@host"); err == nil {
+					candidate.Username = userinfo.User.Username()
+					candidate.Password, _ = userinfo.User.Password()
+				}
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	logger.GetLogger().Info(fmt.Sprintf("🔢 从文本列表中总共提取到 %d 个IP地址", len(candidates)))
+	return candidates
+}
+
+// parseCSVList 📑 解析带表头的 CSV 列表, 无法识别表头时按 "ip,port" 或 "ip:port" 处理
+//
+// 参数:
+//   - content: CSV 内容
+//
+// 返回值:
+//   - []Candidate: 候选代理
+func parseCSVList(content string) []Candidate {
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil || len(rows) == 0 {
+		logger.GetLogger().Warn(fmt.Sprintf("⚠️ CSV 内容解析失败: %v", err))
+		return nil
+	}
+
+	columns := csvHeaderColumns(rows[0])
+	if columns["ip"] >= 0 {
+		rows = rows[1:]
+	} else {
+		columns = map[string]int{"ip": 0, "port": 1, "protocol": -1, "country": -1, "anonymity": -1, "username": -1, "password": -1}
+	}
+
+	cell := func(row []string, name string) string {
+		if index := columns[name]; index >= 0 && index < len(row) {
+			return strings.TrimSpace(row[index])
+		}
+		return ""
+	}
+
+	var candidates []Candidate
+	for _, row := range rows {
+		record := extractedRecord{
+			ip:        cell(row, "ip"),
+			port:      cell(row, "port"),
+			protocol:  cell(row, "protocol"),
+			country:   cell(row, "country"),
+			anonymity: cell(row, "anonymity"),
+		}
+		// "ip:port" 单列时端口列可能是其他内容, 不带方括号的 IPv6 仍使用端口列
+		if _, _, ok := splitAddress(record.ip); ok {
+			record.port = ""
+		}
+		if address, ok := normalizeRecord(record); ok {
+			candidates = append(candidates, Candidate{
+				Address:  address,
+				Username: cell(row, "username"),
+				Password: cell(row, "password"),
+				Hints:    newClaims(record.protocol, record.country, record.anonymity),
+			})
+		}
+	}
+
+	logger.GetLogger().Info(fmt.Sprintf("🔢 从CSV列表中总共提取到 %d 个IP地址", len(candidates)))
+	return candidates
+}
+
+// csvHeaderColumns 根据表头定位各字段所在列, 不存在的字段为 -1
+func csvHeaderColumns(header []string) map[string]int {
+	columns := make(map[string]int, len(csvColumnAliases))
+	for field := range csvColumnAliases {
+		columns[field] = -1
+	}
+
+	for index, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for field, aliases := range csvColumnAliases {
+			for _, alias := range aliases {
+				if name == alias && columns[field] < 0 {
+					columns[field] = index
+				}
+			}
+		}
+	}
+	return columns
+}
+
+// csvSplit 按 CSV 规则拆分单行
+func csvSplit(line string) []string {
+	fields, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err != nil {
+		return nil
+	}
+	return fields
+}
+
+// decodeBase64Blob 尝试将整段内容作为 base64 解码, 解码结果需为可读文本
+func decodeBase64Blob(content string) (string, bool) {
+	compact := strings.Join(strings.Fields(content), "")
+	if len(compact) < 16 || !base64BlobPattern.MatchString(compact) {
+		return "", false
+	}
+
+	var decoded []byte
+	var err error
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if decoded, err = encoding.DecodeString(compact); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", false
+	}
+
+	text := string(decoded)
+	for _, r := range text {
+		if r == unicode.ReplacementChar || (!unicode.IsPrint(r) && !unicode.IsSpace(r)) {
+			return "", false
+		}
+	}
+	return text, true
+}
+
+// nonEmptyLines 返回去除首尾空白后的非空行
+func nonEmptyLines(content string) []string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
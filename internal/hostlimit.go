@@ -0,0 +1,106 @@
+// Author       :loyd
+// Date         :2025-04-06 20:14:38
+// LastEditors  :loyd
+// LastEditTime :2025-04-06 21:52:19
+// Description  :按主机限制代理源请求的并发数与频率
+
+package internal
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostLimiter 限制同一主机的并发请求数, 并保证相邻两次请求之间的最小间隔
+type hostLimiter struct {
+	perHost int
+	delay   time.Duration
+
+	mutex sync.Mutex
+	hosts map[string]*hostSlot
+}
+
+// hostSlot 单个主机的并发槽位与下一次允许请求的时间
+type hostSlot struct {
+	slots chan struct{}
+	next  time.Time
+}
+
+// newHostLimiter 创建主机限流器
+//
+// 参数:
+//   - perHost: 同一主机的最大并发数
+//   - delay: 同一主机两次请求之间的最小间隔
+//
+// 返回值:
+//   - *hostLimiter: 限流器
+func newHostLimiter(perHost int, delay time.Duration) *hostLimiter {
+	return &hostLimiter{perHost: perHost, delay: delay, hosts: make(map[string]*hostSlot)}
+}
+
+// acquire ⏳ 等待获取主机的请求许可
+//
+// 参数:
+//   - ctx: 等待期间被取消时放弃获取
+//   - rawURL: 请求地址, 按主机名(不含端口)限流
+//
+// 返回值:
+//   - func(): 请求结束后调用以释放并发槽位
+//   - error: ctx 被取消时返回其错误
+func (l *hostLimiter) acquire(ctx context.Context, rawURL string) (func(), error) {
+	slot := l.slot(requestHost(rawURL))
+
+	select {
+	case slot.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-slot.slots }
+
+	// 预约下一次请求时间, 并发的请求依次顺延
+	l.mutex.Lock()
+	now := time.Now()
+	start := slot.next
+	if start.Before(now) {
+		start = now
+	}
+	slot.next = start.Add(l.delay)
+	l.mutex.Unlock()
+
+	if wait := time.Until(start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// slot 返回主机对应的槽位, 不存在时创建
+func (l *hostLimiter) slot(host string) *hostSlot {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	slot, ok := l.hosts[host]
+	if !ok {
+		slot = &hostSlot{slots: make(chan struct{}, l.perHost)}
+		l.hosts[host] = slot
+	}
+	return slot
+}
+
+// requestHost 返回URL的小写主机名, 解析失败时返回原始地址
+func requestHost(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return rawURL
+	}
+	return strings.ToLower(parsed.Hostname())
+}
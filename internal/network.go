@@ -0,0 +1,215 @@
+// Author       :loyd
+// Date         :2025-04-05 19:52:26
+// LastEditors  :loyd
+// LastEditTime :2025-04-05 22:37:04
+// Description  :按 ASN、组织名称与反向解析判断代理的网络类型
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+	"zol9527/proxies/pkg/resource"
+)
+
+// 代理的网络类型
+const (
+	networkDatacenter  = "datacenter"
+	networkResidential = "residential"
+	networkMobile      = "mobile"
+	networkUnknown     = "unknown"
+)
+
+// reverseDNSTimeout 单次反向解析超时
+const reverseDNSTimeout = 2 * time.Second
+
+var (
+	// defaultDatacenterASNs 常见云厂商与托管服务商的 ASN
+	defaultDatacenterASNs = []int{
+		16509, 14618, // Amazon
+		15169, 396982, // Google
+		8075,         // Microsoft
+		14061,        // DigitalOcean
+		16276,        // OVH
+		24940,        // Hetzner
+		63949,        // Linode/Akamai
+		20473,        // Vultr/Choopa
+		45102, 37963, // Alibaba
+		132203, 45090, // Tencent
+		55990, // Huawei Cloud
+		31898, // Oracle
+		13335, // Cloudflare
+	}
+	// defaultDatacenterPatterns 机房IP的反向解析域名与组织名称特征
+	defaultDatacenterPatterns = []string{
+		`(?i)` + tokenStart + `(amazon(aws)?|aws|ec2|compute|google(usercontent)?|gcp|cloud(flare)?|azure|microsoft|digitalocean|ovh|hetzner|linode|akamai|vultr|choopa|contabo|leaseweb|m247|` +
+			`hosting|vps|dedicated|servers?|colo(cation|crossing)?|data ?cent(er|re)s?|alibaba|aliyun|tencent|oracle)` + tokenEnd,
+	}
+	// defaultMobilePatterns 移动网络的特征, 数字开头的 3g/4g/5g 需要前后都不是字母数字
+	defaultMobilePatterns = []string{
+		`(?i)` + tokenStart + `(mobile|mobilfunk|movil|mobily|wireless|cellular|lte|gprs|cmnet)` + tokenEnd,
+		`(?i)(^|[^a-z0-9])[345]g([^a-z0-9]|$)`,
+		`(?i)unicom.*wap`,
+	}
+	// defaultResidentialPatterns 家庭宽带的特征
+	defaultResidentialPatterns = []string{
+		`(?i)` + tokenStart + `([avx]?dsl|cable|dyn(amic)?|pool|dhcp|pppoe|ppp|broadband|fib(er|re)|fios|ftth|cpe|residential|customers?|res|hsd|comcast|verizon|charter)` + tokenEnd,
+	}
+)
+
+// 默认规则使用的词边界: 字母以外的字符(数字、点、连字符、空格)都视为分隔,
+// 反向解析域名中 "dsl123" 这样的写法可以匹配, "Colorado"、"ExxonMobil" 这样的单词内部不会误中
+const (
+	tokenStart = `(^|[^a-z])`
+	tokenEnd   = `([^a-z]|$)`
+)
+
+// networkClassifier 网络类型分类器
+type networkClassifier struct {
+	datacenterASNs map[int]bool
+	mobileASNs     map[int]bool
+	datacenter     []*regexp.Regexp
+	mobile         []*regexp.Regexp
+	residential    []*regexp.Regexp
+	reverseDNS     bool
+}
+
+// newNetworkClassifier 🏷️ 根据配置创建分类器, 未配置的规则使用内置默认值
+//
+// 参数:
+//   - config: 网络类型规则
+//
+// 返回值:
+//   - *networkClassifier: 分类器
+//   - error: 正则无效时返回错误
+func newNetworkClassifier(config resource.NetworkConfig) (*networkClassifier, error) {
+	classifier := &networkClassifier{
+		datacenterASNs: intSet(orDefault(config.DatacenterASNs, defaultDatacenterASNs)),
+		mobileASNs:     intSet(config.MobileASNs),
+		reverseDNS:     config.ReverseDNS,
+	}
+
+	var err error
+	if classifier.datacenter, err = compilePatterns(orDefault(config.DatacenterPatterns, defaultDatacenterPatterns)); err != nil {
+		return nil, err
+	}
+	if classifier.mobile, err = compilePatterns(orDefault(config.MobilePatterns, defaultMobilePatterns)); err != nil {
+		return nil, err
+	}
+	if classifier.residential, err = compilePatterns(orDefault(config.ResidentialPatterns, defaultResidentialPatterns)); err != nil {
+		return nil, err
+	}
+	return classifier, nil
+}
+
+// classify 🏷️ 判断单条记录的网络类型
+//
+// 依次使用出口IP(没有时为监听IP)的 ASN 名单、反向解析域名和组织名称,
+// 反向解析域名比组织名称更具体, 因此优先匹配
+//
+// 参数:
+//   - record: 已补全地理位置的验证结果
+//
+// 返回值:
+//   - string: datacenter、residential、mobile 或 unknown
+func (c *networkClassifier) classify(record ProxyRecord) string {
+	ip, info := record.ExitIP, record.ExitGeo
+	if ip == "" {
+		ip, info = listenIP(record), record.Geo
+	}
+
+	if info != nil && info.ASN != 0 {
+		switch {
+		case c.mobileASNs[int(info.ASN)]:
+			return networkMobile
+		case c.datacenterASNs[int(info.ASN)]:
+			return networkDatacenter
+		}
+	}
+
+	var texts []string
+	if c.reverseDNS && ip != "" {
+		texts = append(texts, reverseLookup(ip))
+	}
+	if info != nil {
+		texts = append(texts, info.Org)
+	}
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		switch {
+		case matchAny(c.mobile, text):
+			return networkMobile
+		case matchAny(c.datacenter, text):
+			return networkDatacenter
+		case matchAny(c.residential, text):
+			return networkResidential
+		}
+	}
+	return networkUnknown
+}
+
+// newRecordClassifier 🏷️ 根据完整配置创建分类器
+//
+// 需要 geo.asnDatabase 提供的 ASN 信息或开启 network.reverseDns, 两者都没有时不分类
+//
+// 参数:
+//   - config: 完整配置
+//
+// 返回值:
+//   - *networkClassifier: 分类器, 不需要分类时为 nil
+//   - error: 正则无效时返回错误
+func newRecordClassifier(config *resource.Config) (*networkClassifier, error) {
+	if config.Geo.ASNDatabase == "" && !config.Network.ReverseDNS {
+		return nil, nil
+	}
+	return newNetworkClassifier(config.Network)
+}
+
+// reverseLookup 反向解析IP, 失败时返回空字符串
+func reverseLookup(ip string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), reverseDNSTimeout)
+	defer cancel()
+
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// compilePatterns 编译正则列表
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// matchAny 判断文本是否匹配任一正则
+func matchAny(patterns []*regexp.Regexp, text string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// orDefault 配置为空时返回默认值
+func orDefault[T any](values, defaults []T) []T {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
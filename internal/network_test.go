@@ -0,0 +1,53 @@
+// Author       :loyd
+// Date         :2025-04-13 17:02:11
+// LastEditors  :loyd
+// LastEditTime :2025-04-13 17:30:45
+// Description  :网络类型默认规则测试, 覆盖组织名称与反向解析域名中的常见误判
+
+package internal
+
+import (
+	"testing"
+	"zol9527/proxies/pkg/geo"
+	"zol9527/proxies/pkg/resource"
+)
+
+// TestClassifyDefaultPatterns 校验默认规则按词匹配, 不会命中单词内部的片段
+func TestClassifyDefaultPatterns(t *testing.T) {
+	classifier, err := newNetworkClassifier(resource.NetworkConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		// 误判反例
+		{"Colorado State University", networkUnknown},
+		{"Universidad Nacional de Colombia", networkUnknown},
+		{"ExxonMobil Corporation", networkUnknown},
+		{"China Telecom", networkUnknown},
+		{"Deutsche Telekom AG", networkUnknown},
+		{"Liverpool John Moores University", networkUnknown},
+		{"AS14G Networks", networkUnknown},
+
+		{"ColoCrossing", networkDatacenter},
+		{"DigitalOcean, LLC", networkDatacenter},
+		{"ec2-3-80-1-2.compute-1.amazonaws.com", networkDatacenter},
+		{"static.88-198-1-2.clients.your-server.de", networkDatacenter},
+		{"T-Mobile USA, Inc.", networkMobile},
+		{"Telefonica Movil de Chile", networkMobile},
+		{"ip-10-1.4g.example.net", networkMobile},
+		{"pool-71-168-1-2.nycmny.fios.verizon.net", networkResidential},
+		{"c-73-1-2-3.hsd1.ca.comcast.net", networkResidential},
+		{"adsl123.dynamic.example.net", networkResidential},
+	}
+
+	for _, test := range tests {
+		record := ProxyRecord{ExitIP: "203.0.113.1", ExitGeo: &geo.Info{Org: test.text}}
+		if got := classifier.classify(record); got != test.want {
+			t.Errorf("classify(%q) = %s, want %s", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,541 @@
+// Author       :loyd
+// Date         :2025-04-11 19:48:22
+// LastEditors  :loyd
+// LastEditTime :2025-04-11 23:36:57
+// Description  :抓取到检查的流式管道: 来源 → 去重 → 检查 → 补全 → 写入
+
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"zol9527/proxies/pkg/check"
+	"zol9527/proxies/pkg/geo"
+	"zol9527/proxies/pkg/logger"
+	"zol9527/proxies/pkg/resource"
+
+	"github.com/duke-git/lancet/v2/convertor"
+)
+
+const (
+	// defaultCheckQueueSize 未配置 check.queueSize 时等待检查的候选代理缓冲数量
+	defaultCheckQueueSize = 1024
+	// defaultCheckWorkers 未配置 check.workers 时的检查协程数
+	defaultCheckWorkers = 128
+	// processWorkers 补全地理位置与网络类型(含反向解析)的协程数
+	processWorkers = 16
+	// progressInterval 检查进度日志的输出间隔
+	progressInterval = 10 * time.Second
+	// drainGrace 停止后等待进行中的检查完成的最长时间, 超过后中断检查
+	drainGrace = 15 * time.Second
+	// outputPath 验证结果的导出文件
+	outputPath = "ip.txt"
+)
+
+// pipelineCounters 管道各阶段共享的进度计数
+type pipelineCounters struct {
+	// queued 去重与过滤后进入检查队列的候选代理数量
+	queued atomic.Int64
+	// checked 已完成检查的候选代理数量
+	checked atomic.Int64
+	// skipped 停止后未检查的候选代理数量
+	skipped atomic.Int64
+}
+
+// dedupeCandidates 🧹 去重阶段: 规范化地址, 丢弃无效、保留地址段和重复的候选代理
+//
+// 重复出现的候选代理只合并声明到 index, 不会再次检查; ctx 取消后继续读取 batches 但不再送入检查
+//
+// 参数:
+//   - ctx: 取消时停止送入新的候选代理
+//   - batches: 来源阶段输出的候选代理, 每批对应一个URL或历史文件
+//   - index: 记录已出现地址与合并声明的索引
+//   - counters: 进度计数
+//
+// 返回值:
+//   - <-chan Candidate: 去重后的候选代理, 交给解析阶段, batches 关闭且处理完后关闭
+func dedupeCandidates(ctx context.Context, batches <-chan []Candidate, index *candidateIndex, counters *pipelineCounters) <-chan Candidate {
+	unique := make(chan Candidate, resolveWorkers)
+
+	go func() {
+		defer close(unique)
+		logger := logger.GetLogger()
+
+		received, duplicates, forwarded := 0, 0, 0
+		dropped := make(map[string]int)
+		for batch := range batches {
+			for _, candidate := range batch {
+				received++
+				candidate, reason := sanitizeCandidate(candidate)
+				if reason != "" {
+					dropped[reason]++
+					continue
+				}
+				if !index.add(candidate) {
+					duplicates++
+					continue
+				}
+				select {
+				case unique <- candidate:
+					forwarded++
+				case <-ctx.Done():
+					counters.skipped.Add(1)
+				}
+			}
+		}
+
+		if dropped[addressInvalid] > 0 || dropped[addressReserved] > 0 {
+			logger.Info(fmt.Sprintf("🧼 丢弃 %d 个无效地址和 %d 个保留地址段中的地址", dropped[addressInvalid], dropped[addressReserved]))
+		}
+		logger.Info(fmt.Sprintf("🧹 共收到 %d 个候选代理, 去除 %d 个重复后剩余 %d 个", received, duplicates, forwarded))
+	}()
+
+	return unique
+}
+
+// checkCandidates 🚀 检查阶段: 固定数量的协程持续从队列取出候选代理检查, 不再分批等待
+//
+// ctx 取消后不再取出新的候选代理, 进行中的检查最多再等待 drainGrace
+//
+// 参数:
+//   - ctx: 取消时停止检查新的候选代理
+//   - jobs: 待检查的候选代理
+//   - config: 检查的并发数、自适应并发、单项超时与单个代理的总时限
+//   - counters: 进度计数
+//
+// 返回值:
+//   - <-chan ProxyRecord: 检查通过的代理, 全部检查完成后关闭
+func checkCandidates(ctx context.Context, jobs <-chan Candidate, config resource.CheckConfig, counters *pipelineCounters) <-chan ProxyRecord {
+	workers := config.Workers
+	if workers <= 0 {
+		workers = defaultCheckWorkers
+		if config.Adaptive {
+			workers = defaultAdaptiveMaxWorkers
+		}
+	}
+	checker := check.Checker{Timeout: time.Duration(config.ProbeTimeout) * time.Millisecond}
+	budget := time.Duration(config.Budget) * time.Millisecond
+
+	// 自适应时启动 workers 个协程, 由控制器决定其中同时检查的数量
+	var limiter *adaptiveLimiter
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	if config.Adaptive {
+		limiter = newAdaptiveLimiter(config.MinWorkers, workers)
+		checker.OnDial = limiter.observeDial
+		go limiter.watchControls(watchCtx, config.ControlProxies)
+		logger.GetLogger().Info(fmt.Sprintf("🎚️ 自适应检查并发: 以 %d 校准超时基线后升到 %d, 范围 %d~%d, 对照地址 %d 个",
+			limiter.limit, limiter.start, limiter.min, limiter.max, len(config.ControlProxies)))
+	}
+
+	records := make(chan ProxyRecord, workers)
+	logger.GetLogger().Info(fmt.Sprintf("🚀 使用 %d 个线程进行代理测试 (单项超时: %s, 单个代理时限: %s)",
+		workers, describeDuration(checker.Timeout, "默认"), describeDuration(budget, "不限")))
+
+	probeCtx, cancelProbe := drainContext(ctx, drainGrace)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for candidate := range jobs {
+				if ctx.Err() != nil {
+					counters.skipped.Add(1)
+					continue
+				}
+				// 等待名额期间停止时不再检查
+				if limiter != nil && limiter.acquire(ctx) != nil {
+					counters.skipped.Add(1)
+					continue
+				}
+				record, ok := checkCandidate(probeCtx, checker, budget, candidate)
+				if limiter != nil {
+					limiter.release()
+				}
+				counters.checked.Add(1)
+				if ok {
+					records <- record
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		stopWatch()
+		cancelProbe()
+		if limiter != nil {
+			logger.GetLogger().Info(fmt.Sprintf("🎚️ 检查结束时的并发: %s", limiter.summary()))
+		}
+		close(records)
+	}()
+
+	return records
+}
+
+// drainContext ⏳ 返回在 ctx 取消后再过 grace 才取消的上下文, 让进行中的检查有机会完成
+//
+// 参数:
+//   - ctx: 父上下文
+//   - grace: 父上下文取消后的宽限时间
+//
+// 返回值:
+//   - context.Context: 延迟取消的上下文
+//   - context.CancelFunc: 立即取消并释放资源
+func drainContext(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	drain, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() { time.AfterFunc(grace, cancel) })
+	return drain, func() {
+		stop()
+		cancel()
+	}
+}
+
+// checkCandidate 🔍 测试单个代理的可用性和类型
+//
+// 来源声明为 socks 的代理先进行 SOCKS5 握手检查, 其余先进行 HTTP 检查,
+// 基本可用后并行检查 HTTP、HTTPS、SOCKS5、匿名度与出口IP
+//
+// 参数:
+//   - ctx: 取消时中断检查
+//   - checker: 带单项超时的检查器
+//   - budget: 全部检查项的总时限, 0 表示不限制
+//   - candidate: 候选代理
+//
+// 返回值:
+//   - ProxyRecord: 验证结果, 域名代理同时记录解析到的IP
+//   - bool: 是否可用, 检查被中断或超过总时限时为 false
+func checkCandidate(ctx context.Context, checker check.Checker, budget time.Duration, candidate Candidate) (ProxyRecord, bool) {
+	if budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+	ip := candidate.ProxyAddress()
+
+	// 按来源声明的协议决定首个检查项, 这是基本可用性检查
+	var isHttp, isSocket5 bool
+	httpChecked, socksChecked := false, false
+	if strings.HasPrefix(candidate.Hints.Protocol, "socks") {
+		isSocket5, socksChecked = checker.CheckSocket5Response(ctx, ip), true
+	}
+	if !isSocket5 {
+		isHttp, httpChecked = checker.FastCheckHttp(ctx, ip), true
+	}
+	if !isHttp && !isSocket5 {
+		return ProxyRecord{}, false
+	}
+
+	// 并行检查其他功能
+	var isHttps bool
+	var anonymity, exitIP string
+	var wg sync.WaitGroup
+
+	// 检查HTTP
+	if !httpChecked {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			isHttp = checker.FastCheckHttp(ctx, ip)
+		}()
+	}
+
+	// 检查HTTPS
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		isHttps = checker.CheckHttpsResponse(ctx, ip, "", "")
+	}()
+
+	// 检查SOCKS5
+	if !socksChecked {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			isSocket5 = checker.CheckSocket5Response(ctx, ip)
+		}()
+	}
+
+	// 检查匿名性与出口IP
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		anonymity, exitIP = checker.CheckProxyExit(ctx, ip)
+	}()
+
+	// 等待所有检查完成, 中断或超过总时限时的结果不完整, 不作为有效代理
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ProxyRecord{}, false
+	}
+
+	var resolved string
+	if len(candidate.Resolved) > 0 {
+		resolved = candidate.Resolved[0].String()
+	}
+	return ProxyRecord{
+		IP:        candidate.Address,
+		Resolved:  resolved,
+		Http:      isHttp,
+		Https:     isHttps,
+		Socks5:    isSocket5,
+		Anonymity: anonymity,
+		ExitIP:    exitIP,
+		Source:    candidate.Source,
+		Auth:      candidate.Username != "",
+
+		resolvedAddrs: candidate.Resolved,
+	}, true
+}
+
+// recordProcessor 检查通过后的处理: 名单复核、地理位置补全与网络类型分类
+type recordProcessor struct {
+	filter     *ProxyFilter
+	locator    *geo.Locator
+	classifier *networkClassifier
+}
+
+// processedRecord 处理后的验证结果
+type processedRecord struct {
+	record ProxyRecord
+	// rejected 导出前被名单拒绝的原因, 允许时为空
+	rejected string
+	// located 是否查询到地理位置
+	located bool
+}
+
+// processRecords 🗺️ 补全阶段: 导出前按名单复核(域名代理使用检查时解析到的IP), 再补全地理位置和网络类型
+//
+// 反向解析可能较慢, 因此使用独立的协程池, 不占用检查协程
+//
+// 参数:
+//   - records: 检查通过的代理
+//   - processor: 名单、地理位置与网络类型的处理器
+//
+// 返回值:
+//   - <-chan processedRecord: 处理后的结果, records 关闭且处理完后关闭
+func processRecords(records <-chan ProxyRecord, processor recordProcessor) <-chan processedRecord {
+	results := make(chan processedRecord, processWorkers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < processWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for record := range records {
+				result := processedRecord{record: record}
+				if ok, reason := processor.filter.Allow(record.IP, record.resolvedAddrs); !ok {
+					result.rejected = reason
+					results <- result
+					continue
+				}
+				result.located = enrichRecord(processor.locator, &result.record)
+				if processor.classifier != nil {
+					result.record.NetworkType = processor.classifier.classify(result.record)
+				}
+				results <- result
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// recordWriter 逐条写入验证结果, 先写临时文件, 完成后替换导出文件
+type recordWriter struct {
+	path    string
+	file    *os.File
+	buffer  *bufio.Writer
+	written int
+}
+
+// newRecordWriter 📝 创建导出文件的临时文件
+//
+// 参数:
+//   - path: 导出文件路径
+//
+// 返回值:
+//   - *recordWriter: 写入器
+//   - error: 无法创建临时文件时返回错误
+func newRecordWriter(path string) (*recordWriter, error) {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &recordWriter{path: path, file: file, buffer: bufio.NewWriter(file)}, nil
+}
+
+// write 写入一条验证结果
+func (w *recordWriter) write(record ProxyRecord) error {
+	jsonStr, err := convertor.ToJson(record)
+	if err != nil {
+		return err
+	}
+	if _, err := w.buffer.WriteString(jsonStr + "\n"); err != nil {
+		return err
+	}
+	w.written++
+	return nil
+}
+
+// close 💾 写完临时文件并替换导出文件
+func (w *recordWriter) close() error {
+	if err := w.buffer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(w.file.Name(), w.path)
+}
+
+// pipelineSink 写入阶段的统计
+type pipelineSink struct {
+	index    *candidateIndex
+	export   exportFilter
+	writer   *recordWriter
+	counters *pipelineCounters
+
+	valid, http, https, socks5, located, exported int
+	networkTypes                                  map[string]int
+	rejected                                      map[string]int
+	honesty                                       sourceHonesty
+}
+
+// sinkResults 💾 写入阶段: 合并最终声明、统计结果并按导出条件逐条写入文件
+//
+// 参数:
+//   - results: 处理后的验证结果
+//   - index: 候选代理索引, 用于读取合并后的来源声明
+//   - export: 导出条件
+//   - writer: 导出文件写入器
+//   - counters: 进度计数
+//   - processor: 用于判断是否输出补全与分类统计
+func sinkResults(results <-chan processedRecord, index *candidateIndex, export exportFilter, writer *recordWriter, counters *pipelineCounters, processor recordProcessor) {
+	logger := logger.GetLogger()
+	sink := &pipelineSink{
+		index:        index,
+		export:       export,
+		writer:       writer,
+		counters:     counters,
+		networkTypes: make(map[string]int),
+		rejected:     make(map[string]int),
+		honesty:      make(sourceHonesty),
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				sink.finish(processor)
+				return
+			}
+			sink.add(result)
+		case <-ticker.C:
+			logger.Info(fmt.Sprintf("🔄 代理测试进度: %d/%d, 有效 %d 个",
+				counters.checked.Load(), counters.queued.Load(), sink.valid))
+		}
+	}
+}
+
+// add 统计并写入一条结果
+func (s *pipelineSink) add(result processedRecord) {
+	record := result.record
+	if claimed := s.index.claims(record.IP); !claimed.IsZero() {
+		record.Claimed = &claimed
+	}
+
+	s.valid++
+	if record.Http {
+		s.http++
+	}
+	if record.Https {
+		s.https++
+	}
+	if record.Socks5 {
+		s.socks5++
+	}
+	s.honesty.add(record)
+
+	if result.rejected != "" {
+		s.rejected[result.rejected]++
+		return
+	}
+	if result.located {
+		s.located++
+	}
+	s.networkTypes[record.networkType()]++
+	if !s.export.allow(record) {
+		return
+	}
+	s.exported++
+	if err := s.writer.write(record); err != nil {
+		logger.GetLogger().Warn(fmt.Sprintf("⚠️ 写入代理记录失败 [%s]: %v", record.IP, err))
+	}
+}
+
+// finish 输出汇总日志并替换导出文件
+func (s *pipelineSink) finish(processor recordProcessor) {
+	logger := logger.GetLogger()
+
+	total := s.counters.checked.Load()
+	if s.valid > 0 {
+		logger.Info(fmt.Sprintf("✅ 代理测试完成: 共测试 %d 个IP, 有效IP %d 个 (成功率: %.1f%%)",
+			total, s.valid, float64(s.valid)/float64(total)*100))
+		logger.Info(fmt.Sprintf("📊 代理类型统计: HTTP: %d, HTTPS: %d, SOCKS5: %d", s.http, s.https, s.socks5))
+		s.honesty.log()
+	} else {
+		logger.Warn(fmt.Sprintf("⚠️ 代理测试完成: 共测试 %d 个IP, 未找到有效代理", total))
+	}
+
+	if skipped := s.counters.skipped.Load(); skipped > 0 {
+		logger.Warn(fmt.Sprintf("⏹️ 运行提前结束, %d 个候选代理未检查, 写入已验证的部分结果", skipped))
+	}
+	logRejected("导出记录", s.rejected)
+	allowed := s.valid - sumCounts(s.rejected)
+	if processor.locator != nil {
+		logger.Info(fmt.Sprintf("🗺️ 地理位置补全: %d/%d 个代理", s.located, allowed))
+	}
+	if processor.classifier != nil {
+		logger.Info(fmt.Sprintf("🏷️ 网络类型统计: 机房 %d, 家庭宽带 %d, 移动网络 %d, 未知 %d",
+			s.networkTypes[networkDatacenter], s.networkTypes[networkResidential], s.networkTypes[networkMobile], s.networkTypes[networkUnknown]))
+	}
+	if s.export.enabled() {
+		logger.Info(fmt.Sprintf("📤 按国家 %v 与网络类型 %v 筛选后导出 %d/%d 个代理",
+			s.export.countries, s.export.networkTypes, s.exported, allowed))
+	}
+
+	if err := s.writer.close(); err != nil {
+		logger.Error(fmt.Sprintf("❌ 写入文件 %s 失败: %v", s.writer.path, err))
+		return
+	}
+	logger.Info(fmt.Sprintf("💾 成功写入 %d 个IP到文件 %s", s.writer.written, s.writer.path))
+}
+
+// describeDuration 格式化时长, 为 0 时返回 zero
+func describeDuration(duration time.Duration, zero string) string {
+	if duration <= 0 {
+		return zero
+	}
+	return duration.String()
+}
+
+// sumCounts 计算各原因数量之和
+func sumCounts(counts map[string]int) int {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total
+}
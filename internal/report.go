@@ -0,0 +1,139 @@
+// Author       :loyd
+// Date         :2025-04-07 21:16:02
+// LastEditors  :loyd
+// LastEditTime :2025-04-07 23:08:37
+// Description  :每轮抓取的运行报告
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"zol9527/proxies/pkg/logger"
+)
+
+// 单个URL的抓取结果
+const (
+	fetchStatusOK    = "ok"
+	fetchStatusEmpty = "empty"
+	fetchStatusError = "error"
+	// fetchStatusBlocked 来源返回了反爬拦截页面, 与空列表区分
+	fetchStatusBlocked = "blocked"
+)
+
+// FetchReport 单个URL的抓取结果
+type FetchReport struct {
+	Platform   string `json:"platform"`
+	URL        string `json:"url"`
+	Status     string `json:"status"`
+	Category   string `json:"category,omitempty"`
+	HTTPStatus int    `json:"httpStatus,omitempty"`
+	Attempts   int    `json:"attempts"`
+	Candidates int    `json:"candidates"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// RunReport 一轮抓取的运行报告, 可被多个抓取协程并发写入
+type RunReport struct {
+	StartedAt  time.Time     `json:"startedAt"`
+	FinishedAt time.Time     `json:"finishedAt"`
+	Fetches    []FetchReport `json:"fetches"`
+
+	mutex sync.Mutex
+}
+
+// newRunReport 创建从当前时间开始的运行报告
+func newRunReport() *RunReport {
+	return &RunReport{StartedAt: time.Now()}
+}
+
+// recordFetch 📝 记录单个URL的抓取结果
+//
+// 参数:
+//   - platform: 平台名称
+//   - rawURL: 请求地址
+//   - candidates: 解析到的候选代理数量
+//   - attempts: 请求次数
+//   - err: 最终错误, 成功时为 nil
+//   - duration: 含重试在内的总耗时
+func (r *RunReport) recordFetch(platform, rawURL string, candidates, attempts int, err error, duration time.Duration) {
+	entry := FetchReport{
+		Platform:   platform,
+		URL:        rawURL,
+		Status:     fetchStatusOK,
+		Attempts:   attempts,
+		Candidates: candidates,
+		DurationMs: duration.Milliseconds(),
+	}
+	if candidates == 0 {
+		entry.Status = fetchStatusEmpty
+	}
+	if err != nil {
+		entry.Status = fetchStatusError
+		entry.Error = err.Error()
+		var fetchErr *fetchError
+		if errors.As(err, &fetchErr) {
+			entry.Category = fetchErr.Category
+			entry.HTTPStatus = fetchErr.Status
+			if fetchErr.Category == errorBlocked {
+				entry.Status = fetchStatusBlocked
+			}
+		}
+	}
+
+	r.mutex.Lock()
+	r.Fetches = append(r.Fetches, entry)
+	r.mutex.Unlock()
+}
+
+// finish 📊 结束报告, 输出汇总日志并按需写入文件
+//
+// 参数:
+//   - path: 报告文件路径, 为空时不写文件
+func (r *RunReport) finish(path string) {
+	logger := logger.GetLogger()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.FinishedAt = time.Now()
+	sort.SliceStable(r.Fetches, func(i, j int) bool { return r.Fetches[i].Platform < r.Fetches[j].Platform })
+
+	statuses := make(map[string]int)
+	categories := make(map[string]int)
+	for _, fetch := range r.Fetches {
+		statuses[fetch.Status]++
+		if fetch.Category != "" {
+			categories[fetch.Category]++
+		}
+	}
+
+	var details []string
+	for category, count := range categories {
+		details = append(details, fmt.Sprintf("%s=%d", category, count))
+	}
+	sort.Strings(details)
+	logger.Info(fmt.Sprintf("📊 抓取报告: 共 %d 个URL, 成功 %d, 空页 %d, 被拦截 %d, 失败 %d %s",
+		len(r.Fetches), statuses[fetchStatusOK], statuses[fetchStatusEmpty], statuses[fetchStatusBlocked],
+		statuses[fetchStatusError], strings.Join(details, " ")))
+
+	if path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		logger.Warn(fmt.Sprintf("⚠️ 生成抓取报告失败: %v", err))
+		return
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		logger.Warn(fmt.Sprintf("⚠️ 写入抓取报告失败 [%s]: %v", path, err))
+		return
+	}
+	logger.Info(fmt.Sprintf("💾 抓取报告已写入 %s", path))
+}
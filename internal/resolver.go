@@ -0,0 +1,189 @@
+// Author       :loyd
+// Date         :2025-04-13 19:24:16
+// LastEditors  :loyd
+// LastEditTime :2025-04-13 21:05:48
+// Description  :域名代理的解析阶段, 丢弃解析到保留地址段或被名单拒绝的候选代理
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+	"zol9527/proxies/pkg/logger"
+)
+
+const (
+	// resolveWorkers 同时解析域名的协程数
+	resolveWorkers = 32
+	// resolveTimeout 单个域名的解析超时
+	resolveTimeout = 5 * time.Second
+)
+
+// hostUnresolved 域名代理无法解析时的丢弃原因, 解析到保留地址段时使用 addressReserved
+const hostUnresolved = "unresolved"
+
+// hostResolver 带缓存的域名解析器, 同一域名在一轮爬取中只解析一次
+type hostResolver struct {
+	timeout time.Duration
+	// lookupNetIP 实际的解析函数, 默认使用 net.DefaultResolver
+	lookupNetIP func(ctx context.Context, network, host string) ([]netip.Addr, error)
+	mutex       sync.Mutex
+	entries     map[string]*resolvedHost
+}
+
+// resolvedHost 一个域名的解析结果, done 关闭后 addrs 可读
+type resolvedHost struct {
+	done  chan struct{}
+	addrs []netip.Addr
+}
+
+// newHostResolver 创建域名解析器
+func newHostResolver(timeout time.Duration) *hostResolver {
+	return &hostResolver{
+		timeout:     timeout,
+		lookupNetIP: net.DefaultResolver.LookupNetIP,
+		entries:     make(map[string]*resolvedHost),
+	}
+}
+
+// lookup 🔭 解析域名的全部IP, 并发请求同一域名时等待第一次解析的结果
+//
+// 参数:
+//   - ctx: 取消时中断解析
+//   - host: 域名
+//
+// 返回值:
+//   - []netip.Addr: 解析到的IP, 解析失败时为空
+func (r *hostResolver) lookup(ctx context.Context, host string) []netip.Addr {
+	r.mutex.Lock()
+	entry, ok := r.entries[host]
+	if !ok {
+		entry = &resolvedHost{done: make(chan struct{})}
+		r.entries[host] = entry
+	}
+	r.mutex.Unlock()
+
+	if ok {
+		select {
+		case <-entry.done:
+			return entry.addrs
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	addrs, err := r.lookupNetIP(lookupCtx, "ip", host)
+	if err == nil {
+		for i := range addrs {
+			addrs[i] = addrs[i].Unmap()
+		}
+		entry.addrs = addrs
+	}
+	close(entry.done)
+	return entry.addrs
+}
+
+// resolveCandidate 解析域名代理, 任一解析结果属于私有、回环或保留地址段时丢弃
+//
+// 参数:
+//   - ctx: 取消时中断解析
+//   - candidate: 地址已规范化的候选代理
+//
+// 返回值:
+//   - Candidate: 域名代理记录全部解析结果, IP 地址原样返回
+//   - string: 丢弃原因 unresolved 或 reserved, 可以使用时为空
+func (r *hostResolver) resolveCandidate(ctx context.Context, candidate Candidate) (Candidate, string) {
+	host, _, ok := splitAddress(candidate.Address)
+	if !ok || !isHostnameAddress(candidate.Address) {
+		return candidate, ""
+	}
+
+	addrs := r.lookup(ctx, host)
+	if len(addrs) == 0 {
+		return candidate, hostUnresolved
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return candidate, addressReserved
+		}
+	}
+	candidate.Resolved = addrs
+	return candidate, ""
+}
+
+// resolveCandidates 🔭 解析阶段: 多个协程并发解析域名代理并执行名单过滤
+//
+// 解析在检查前完成, 避免探测指向本机或内网的域名; 名单的网段与 ASN 规则使用这里的解析结果,
+// 单个域名解析缓慢不会阻塞去重阶段和其他候选代理
+//
+// 参数:
+//   - ctx: 取消时停止解析并不再送入检查
+//   - candidates: 去重后的候选代理
+//   - resolver: 域名解析器
+//   - filter: 名单过滤器
+//   - queueSize: 待检查队列的缓冲数量
+//   - counters: 进度计数
+//
+// 返回值:
+//   - <-chan Candidate: 待检查的候选代理, candidates 关闭且处理完后关闭
+func resolveCandidates(ctx context.Context, candidates <-chan Candidate, resolver *hostResolver, filter *ProxyFilter, queueSize int, counters *pipelineCounters) <-chan Candidate {
+	if queueSize <= 0 {
+		queueSize = defaultCheckQueueSize
+	}
+	jobs := make(chan Candidate, queueSize)
+
+	var mutex sync.Mutex
+	dropped := make(map[string]int)
+	rejected := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < resolveWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for candidate := range candidates {
+				if ctx.Err() != nil {
+					counters.skipped.Add(1)
+					continue
+				}
+				candidate, reason := resolver.resolveCandidate(ctx, candidate)
+				if reason != "" {
+					mutex.Lock()
+					dropped[reason]++
+					mutex.Unlock()
+					continue
+				}
+				if ok, reason := filter.Allow(candidate.Address, candidate.Resolved); !ok {
+					mutex.Lock()
+					rejected[reason]++
+					mutex.Unlock()
+					continue
+				}
+				select {
+				case jobs <- candidate:
+					counters.queued.Add(1)
+				case <-ctx.Done():
+					counters.skipped.Add(1)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(jobs)
+		if dropped[hostUnresolved] > 0 || dropped[addressReserved] > 0 {
+			logger.GetLogger().Info(fmt.Sprintf("🔭 丢弃 %d 个无法解析和 %d 个解析到保留地址段的域名代理",
+				dropped[hostUnresolved], dropped[addressReserved]))
+		}
+		logRejected("候选代理", rejected)
+		logger.GetLogger().Info(fmt.Sprintf("📥 待测试IP: %d 个", counters.queued.Load()))
+	}()
+
+	return jobs
+}
@@ -9,173 +9,363 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"net/netip"
 	"regexp"
-	"runtime"
 	"strconv"
 	"strings"
 	"sync"
-	"sync/atomic"
-	"zol9527/proxies/pkg/check"
+	"time"
+	"zol9527/proxies/pkg/geo"
 	"zol9527/proxies/pkg/logger"
 	"zol9527/proxies/pkg/resource"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/duke-git/lancet/v2/convertor"
 	"github.com/duke-git/lancet/v2/fileutil"
-	"github.com/duke-git/lancet/v2/netutil"
-	"github.com/duke-git/lancet/v2/slice"
 	"github.com/duke-git/lancet/v2/strutil"
-	"github.com/duke-git/lancet/v2/validator"
 )
 
-// LoadConfiguration 📂 加载并返回配置信息 LoadConfiguration 📂 加载并返回配置信息
+// LoadConfiguration 📂 加载并返回配置信息
 //
 // 该函数执行以下操作：
-// 1. 获取默认配置文件路径
-// 2. 从配置文件中读取配置信息 2. 从配置文件中读取配置信息
+// 1. 按 --config > PROXIES_CONFIG > 默认位置 的顺序解析配置文件路径
+// 2. 从配置文件中读取配置信息
+// 3. 依次应用环境变量和命令行 --set 覆盖
+//
+// 参数:
+//   - configPath: 命令行指定的配置文件路径, 为空时使用环境变量或默认位置
+//   - overrides: 命令行覆盖项, 格式为 "section.key=value"
 //
 // 返回值:
-//   - *resource.Config: 包含所有配置信息的配置对象   - *resource.Config: 包含所有配置信息的配置对象
+//   - *resource.Config: 包含所有配置信息的配置对象
 //
 // 注意：如果在获取配置文件路径或加载配置过程中发生错误，函数会触发panic
-func LoadConfiguration() *resource.Config {
-	// 加载配置
-	path, err := resource.DefaultConfigPath()
+func LoadConfiguration(configPath string, overrides []string) *resource.Config {
+	config, err := resource.LoadWithOverrides(configPath, overrides)
 	if err != nil {
 		panic(err)
 	}
-	// 读取配置
-	config, loadErr := resource.LoadConfig(path)
-	if loadErr != nil {
-		panic(loadErr)
-	}
 
 	return config
 }
 
-// RequestPage 🌐 从指定的配置中获取网页内容并解析出IP地址 RequestPage 🌐 从指定的配置中获取网页内容并解析出IP地址
+// RequestPage 🌐 从指定的配置中获取网页内容并解析出IP地址
 //
-// 该函数接收一个资源配置指针作为参数，遍历配置中的所有平台和URL，L，
-// 向每个URL发送HTTP请求，然后解析响应内容以提取IP地址。 向每个URL发送HTTP请求，然后解析响应内容以提取IP地址。
+// 抓取全部来源后一次性返回, 适合离线回放与调试; Scrape 使用流式的 fetchSources
 //
 // 参数:
-//   - config: 资源配置指针，包含平台、URL等信息   - config: 资源配置指针，包含平台、URL等信息
+//   - ctx: 取消时停止发起新的请求并返回已收集到的结果
+//   - config: 资源配置指针，包含平台、URL等信息
 //
 // 返回值:
-//   - []string: 从所有URL中提取的IP地址列表   - []string: 从所有URL中提取的IP地址列表
+//   - []Candidate: 从所有URL中提取的候选代理, 按请求完成的先后排列
+func RequestPage(ctx context.Context, config *resource.Config) []Candidate {
+	var mutex sync.Mutex
+	var candidates []Candidate
+	fetchSources(ctx, config, func(extracted []Candidate) {
+		mutex.Lock()
+		candidates = append(candidates, extracted...)
+		mutex.Unlock()
+	})
+
+	logger.GetLogger().Info(fmt.Sprintf("🔍 总共收集到 %d 个IP地址", len(candidates)))
+	return candidates
+}
+
+// fetchSources 🌐 并发请求全部来源, 每个URL解析完成后立即交给 emit
+//
+// 展开配置中所有平台的URL(含模板展开的地址)，按 [fetch] 配置并发请求每个URL，然后解析响应内容以提取IP地址。
+//
+// 参数:
+//   - ctx: 取消时中断进行中的请求, 不再发起新的请求
+//   - config: 资源配置指针，包含平台、URL等信息
+//   - emit: 接收单个URL解析到的候选代理, 会被多个抓取协程并发调用, 阻塞时抓取随之放缓
 //
 // 注意:
 //   - 如果请求失败或解析不到IP地址，将记录错误或警告日志，并继续处理下一个URL
-func RequestPage(config *resource.Config) []string {
+//   - 每个URL的结果与错误分类汇总到运行报告, 配置 fetch.report 时写入文件
+//   - 同一组URL(同一模板的不同页码)按顺序请求, 开启 stopOnEmpty 的平台在某页解析不到IP时跳过同组后续页码
+//   - 同一主机的请求受 perHost 并发数与 hostDelay 间隔限制
+//   - 到达 deadline 或 ctx 取消后取消未完成的请求, 等待抓取协程退出后返回, 返回后不会再调用 emit
+func fetchSources(parent context.Context, config *resource.Config, emit func([]Candidate)) {
 	logger := logger.GetLogger()
-	var ips []string
 
-	// 遍历全部的平台, 每个平台可能有多个 URL
+	// 展开全部平台的 URL 组, 每组作为一个并发任务
+	var tasks []fetchTask
 	for _, platform := range config.Platforms {
-		for _, url := range platform.URLs {
-			// 发送 HTTP 请求
-			request := &netutil.HttpRequest{
-				RawURL: url,
-				Method: platform.Method,
-			}
-			client := netutil.NewHttpClient()
-			resp, err := client.SendRequest(request)
-			if err != nil {
-				// 处理错误
-				logger.Error(fmt.Sprintf("❌ 请求失败 [%s]: %v", url, err))
-				continue
-			}
+		groups, err := platform.URLGroups()
+		if err != nil {
+			logger.Error(fmt.Sprintf("❌ 展开URL模板失败 [%s]: %v", platform.Name, err))
+			continue
+		}
+		retries := fetchRetries(platform, config.Fetch)
+		for _, group := range groups {
+			tasks = append(tasks, fetchTask{platform: platform, urls: group, retries: retries})
+		}
+	}
 
-			// 转化 http response 为字符串串
-			defer resp.Body.Close()
-			byteContent, readErr := io.ReadAll(resp.Body)
-			if readErr != nil {
-				// 处理读取错误
-				logger.Error(fmt.Sprintf("❌ 读取响应内容失败 [%s]: %v", url, readErr))
-				continue
-			}
-			strContent := string(byteContent)
+	workers := config.Fetch.Workers
+	if workers <= 0 {
+		workers = defaultFetchWorkers
+	}
+	perHost := config.Fetch.PerHost
+	if perHost <= 0 {
+		perHost = defaultFetchPerHost
+	}
+	fixtures, err := newFixtureStore(config.Fixture)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("⚠️ 无法录制来源响应, 按正常模式抓取: %v", err))
+	}
+	hostDelay := time.Duration(config.Fetch.HostDelay) * time.Millisecond
+	if fixtures != nil {
+		logger.Info(fmt.Sprintf("📼 来源响应%s模式, 目录: %s", map[string]string{fixtureRecord: "录制", fixtureReplay: "回放"}[fixtures.mode], fixtures.dir))
+		// 回放不访问网络, 无需限制请求间隔
+		if fixtures.mode == fixtureReplay {
+			hostDelay = 0
+		}
+	}
 
-			// 解析 HTML 中的 URL
-			extractedIPs := ParseURLs(strContent)
-			if len(extractedIPs) == 0 {
-				logger.Warn(fmt.Sprintf("⚠️ 未在URL中找到可用IP地址: %s", url))
-				continue
+	// 录制时不发送条件请求, 否则未变化的来源会把空的 304 响应录制下来, 回放时无法解析
+	cache := loadSourceCache(config.Cache)
+	if cache != nil && fixtures != nil && fixtures.mode == fixtureRecord {
+		logger.Info("📼 录制模式不使用响应缓存, 每个来源都会完整下载")
+		cache = nil
+	}
+
+	session := &fetchSession{
+		limiter:  newHostLimiter(perHost, hostDelay),
+		report:   newRunReport(),
+		cache:    cache,
+		fixtures: fixtures,
+	}
+
+	// 开启 proxy 的平台被拦截时使用上一轮验证通过的代理中转
+	for _, task := range tasks {
+		if task.platform.Proxy {
+			session.relays = loadRelayProxies()
+			break
+		}
+	}
+
+	ctx := parent
+	if config.Fetch.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.Fetch.Deadline)*time.Second)
+		defer cancel()
+	}
+
+	logger.Info(fmt.Sprintf("🌐 使用 %d 个并发抓取 %d 组URL (每个主机最多 %d 个并发)", workers, len(tasks), perHost))
+
+	queue := make(chan fetchTask)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				fetchGroup(ctx, session, task, emit)
 			}
+		}()
+	}
 
-			// 处理解析到的 IP
-			ips = append(ips, extractedIPs...)
-			logger.Info(fmt.Sprintf("✅ 从 %s 成功解析到 %d 个IP地址", url, len(extractedIPs)))
+feed:
+	for _, task := range tasks {
+		select {
+		case queue <- task:
+		case <-ctx.Done():
+			break feed
 		}
 	}
+	close(queue)
+
+	// 请求与限流等待都受 ctx 控制, 超时后抓取协程会很快退出
+	wg.Wait()
+	switch {
+	case parent.Err() != nil:
+		logger.Warn("⏹️ 抓取已取消, 使用已收集到的结果继续")
+	case ctx.Err() != nil:
+		logger.Warn(fmt.Sprintf("⏰ 抓取超过 %d 秒时限, 使用已收集到的结果继续", config.Fetch.Deadline))
+	}
 
-	logger.Info(fmt.Sprintf("🔍 总共收集到 %d 个IP地址", len(ips)))
-	return ips
+	session.report.finish(config.Fetch.Report)
+	session.cache.save()
+}
+
+// fetchTask 一组需要按顺序请求的URL
+type fetchTask struct {
+	platform resource.PlatformConfig
+	urls     []string
+	retries  int
+}
+
+// fetchRetries 返回平台的重试次数: 优先使用平台的 retries, 其次 fetch.retries(-1 表示不重试), 都未配置时使用默认值
+func fetchRetries(platform resource.PlatformConfig, fetch resource.FetchConfig) int {
+	switch {
+	case platform.Retries != nil:
+		return *platform.Retries
+	case fetch.Retries < 0:
+		return 0
+	case fetch.Retries > 0:
+		return fetch.Retries
+	}
+	return defaultFetchRetries
+}
+
+// fetchSession 一轮抓取中各URL组共享的状态
+type fetchSession struct {
+	// limiter 主机限流器
+	limiter *hostLimiter
+	// report 记录每个URL结果的运行报告
+	report *RunReport
+	// relays 被拦截时可用于中转的代理
+	relays []relayProxy
+	// cache 来源响应缓存, 未配置时为 nil
+	cache *sourceCache
+	// fixtures 来源响应的录制/回放目录, 未开启时为 nil
+	fixtures *fixtureStore
+}
+
+// fetchGroup 📑 按顺序请求同一组URL, 每次请求前获取主机许可
+//
+// 参数:
+//   - ctx: 抓取时限, 到期后不再发起新的请求
+//   - session: 本轮抓取共享的限流器、报告、中转代理、缓存与录制目录
+//   - task: URL组
+//   - emit: 接收每个URL解析到的候选代理
+func fetchGroup(ctx context.Context, session *fetchSession, task fetchTask, emit func([]Candidate)) {
+	logger := logger.GetLogger()
+
+	for _, url := range task.urls {
+		release, err := session.limiter.acquire(ctx, url)
+		if err != nil {
+			break
+		}
+		started := time.Now()
+		extracted, attempts, err := fetchPage(ctx, session, task.platform, url, task.retries)
+		release()
+		session.report.recordFetch(task.platform.Name, url, len(extracted), attempts, err, time.Since(started))
+		if isBlocked(err) {
+			logger.Warn(fmt.Sprintf("🧱 来源被反爬页面拦截 [%s]: %v", url, err))
+			continue
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("❌ 请求失败 [%s]: %v", url, err))
+			continue
+		}
+
+		if len(extracted) == 0 {
+			logger.Warn(fmt.Sprintf("⚠️ 未在URL中找到可用IP地址: %s", url))
+			// 空页之后的页码通常也为空, 按配置跳过同组剩余页
+			if task.platform.StopOnEmpty {
+				break
+			}
+			continue
+		}
+
+		// 处理解析到的 IP
+		logger.Info(fmt.Sprintf("✅ 从 %s 成功解析到 %d 个IP地址", url, len(extracted)))
+		emit(extracted)
+	}
 }
 
-// Scrape 🚀 爬取、测试和输出代理IP的主函数 Scrape 🚀 爬取、测试和输出代理IP的主函数
+// Scrape 🚀 爬取、测试和输出代理IP的主函数
+//
+// 该函数以流式管道执行完整的代理收集流程, 各阶段同时进行:
+// 1. 加载之前缓存的IP, 并发爬取各来源的IP, 每个URL解析完成后立即送入管道
+// 2. 丢弃无效及保留地址段的IP, 去重后按 [filter] 名单过滤
+// 3. 检查协程持续测试代理的可用性
+// 4. 补全地理位置与网络类型, 按导出条件逐条写入文件
 //
-// 该函数执行完整的代理收集流程:理收集流程:
-// 1. 加载配置信息
-// 2. 爬取各来源的IP
-// 3. 加载之前缓存的IPIP
-// 4. 对IP进行去重
-// 5. 测试代理的可用性
-// 6. 输出有效代理到文件
-func Scrape() {
+// ctx 取消(收到停止信号)或超过 pool.deadline 后不再抓取和检查新的代理,
+// 等待进行中的检查完成(最多 drainGrace), 已验证的部分结果照常写入文件
+//
+// 参数:
+//   - ctx: 控制本轮运行的上下文
+//   - config: 已加载并应用覆盖后的配置
+func Scrape(ctx context.Context, config *resource.Config) {
 	logger := logger.GetLogger()
 
-	// 加载配置并请求页面
-	config := LoadConfiguration()
-	ips := RequestPage(config)
+	if config.Pool.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.Pool.Deadline)*time.Second)
+		defer cancel()
+	}
+	stopLog := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			logger.Warn(fmt.Sprintf("⏰ 本轮运行超过 %d 秒时限, 停止接收新的代理, 等待进行中的检查完成", config.Pool.Deadline))
+			return
+		}
+		logger.Warn("⏹️ 收到停止信号, 停止接收新的代理, 等待进行中的检查完成")
+	})
+	defer stopLog()
 
-	// 加载之前保存的IP
-	previousIPs := LoadPreviousIPs()
-	if len(previousIPs) > 0 {
-		logger.Info(fmt.Sprintf("📂 加载到 %d 个历史IP记录", len(previousIPs)))
-		ips = append(ips, previousIPs...)
+	// 地理位置数据库是可选的, 无法打开时只跳过补全
+	locator, err := geo.NewLocator(config.Geo.Database, config.Geo.ASNDatabase)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("⚠️ 打开地理位置数据库失败, 跳过补全: %v", err))
+	}
+	if locator != nil {
+		defer locator.Close()
 	}
 
-	// 使用lancet的slice.Unique进行去重
-	uniqueIPsSlice := slice.Unique(ips)
+	// 名单过滤器与补全共用 ASN 数据库, 无法创建时不进行任何检查, 避免流量经过被拒绝的网络
+	filter, err := NewProxyFilter(config.Filter, locator.ASNReader())
+	if err != nil {
+		logger.Error(fmt.Sprintf("❌ 创建名单过滤器失败: %v", err))
+		return
+	}
 
-	logger.Info(fmt.Sprintf("🧹 去重后待测试IP: %d 个", len(uniqueIPsSlice)))
+	classifier, err := newRecordClassifier(config)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("⚠️ 网络类型规则无效, 跳过分类: %v", err))
+	}
 
-	// 使用多线程测试 IP 可用性
-	validIPs := TestProxy(uniqueIPsSlice)
-	logger.Info(fmt.Sprintf("✨ 测试后有效IP: %d 个", len(validIPs)))
+	// 先写临时文件, 本轮结束后再替换, 历史IP和中转代理在此期间仍可读取旧文件
+	writer, err := newRecordWriter(outputPath)
+	if err != nil {
+		logger.Error(fmt.Sprintf("❌ 创建文件失败: %v", err))
+		return
+	}
 
-	// 输出写入文件
-	Output(validIPs)
+	// 来源阶段: 历史IP无需等待抓取, 最先进入检查; 每个URL解析完成后立即送入管道
+	batches := make(chan []Candidate)
+	go func() {
+		defer close(batches)
+		if previousIPs := LoadPreviousIPs(); len(previousIPs) > 0 {
+			logger.Info(fmt.Sprintf("📂 加载到 %d 个历史IP记录", len(previousIPs)))
+			batches <- previousIPs
+		}
+		fetchSources(ctx, config, func(extracted []Candidate) { batches <- extracted })
+	}()
+
+	// 去重过滤 → 检查 → 名单复核与补全 → 按导出条件写入文件
+	index := newCandidateIndex()
+	counters := &pipelineCounters{}
+	processor := recordProcessor{filter: filter, locator: locator, classifier: classifier}
+	unique := dedupeCandidates(ctx, batches, index, counters)
+	jobs := resolveCandidates(ctx, unique, newHostResolver(resolveTimeout), filter, config.Check.QueueSize, counters)
+	records := checkCandidates(ctx, jobs, config.Check, counters)
+	results := processRecords(records, processor)
+	sinkResults(results, index, newExportFilter(config.Output), writer, counters, processor)
 }
 
-// LoadPreviousIPs 📋 加载之前收集的IP列表 LoadPreviousIPs 📋 加载之前收集的IP列表
+// LoadPreviousIPs 📋 加载之前收集的IP列表
 //
-// 该函数从ip.txt文件中读取之前保存的IP列表 该函数从ip.txt文件中读取之前保存的IP列表
+// 该函数从ip.txt文件中读取之前保存的IP列表, JSON 记录中的来源和声明会被保留
 //
 // 返回值:
-//   - []string: 之前保存的IP地址列表
-func LoadPreviousIPs() []string {
+//   - []Candidate: 之前保存的候选代理
+func LoadPreviousIPs() []Candidate {
 	logger := logger.GetLogger()
-	// 定义多个可能的文件路径
-	possiblePaths := []string{
-		"ip.txt",       // 当前目录
-		"../ip.txt",    // 父级目录
-		"../../ip.txt", // 父级的父级目录级目录
-		"/tmp/ip.txt",  // 临时目录
-	}
 
 	// 🔍 查找第一个存在的文件路径文件路径
-	filePath := ""
-	for _, path := range possiblePaths {
-		if fileutil.IsExist(path) {
-			filePath = path
-			logger.Info(fmt.Sprintf("📁 找到历史IP文件: %s", filePath))
-			break
-		}
+	filePath := findHistoryFile()
+	if filePath != "" {
+		logger.Info(fmt.Sprintf("📁 找到历史IP文件: %s", filePath))
 	}
 
 	// 如果没有找到文件，使用默认路径
@@ -183,7 +373,7 @@ func LoadPreviousIPs() []string {
 		filePath = "ip.txt" // 默认使用当前目录
 		logger.Debug("📝 未找到现有IP文件，将使用默认路径: ip.txt")
 	}
-	var previousIPs []string
+	var previousIPs []Candidate
 
 	// 检查文件是否存在
 	if !fileutil.IsExist(filePath) {
@@ -227,38 +417,41 @@ func LoadPreviousIPs() []string {
 			if err := json.Unmarshal([]byte(processedLine), &ipInfo); err == nil {
 				// 成功解析为JSON
 				if ipVal, ok := ipInfo["ip"].(string); ok {
-					if strings.Contains(ipVal, ":") {
+					address, ok := "", false
+					if host, port, found := splitAddress(ipVal); found {
 						// IP已包含端口
-						previousIPs = append(previousIPs, ipVal)
-					} else if portVal, ok := ipInfo["port"]; ok {
+						address, ok = normalizeAddress(host, port)
+					} else if portVal, found := ipInfo["port"]; found {
 						// 合并IP和端口
-						portStr := fmt.Sprintf("%v", portVal)
-						previousIPs = append(previousIPs, fmt.Sprintf("%s:%s", ipVal, portStr))
+						address, ok = normalizeAddress(ipVal, fmt.Sprintf("%v", portVal))
+					}
+					if ok {
+						previousIPs = append(previousIPs, historyCandidate(address, ipInfo))
 					}
 					continue
 				}
 			}
 
 			// JSON解析失败，尝试使用正则表达式提取
-			ipRegex := regexp.MustCompile(`"ip"\s*:\s*"((?:\d{1,3}\.){3}\d{1,3}(?::\d{1,5})?)"`)
+			ipRegex := regexp.MustCompile(`"ip"\s*:\s*"([^"]+)"`)
 			matches := ipRegex.FindStringSubmatch(processedLine)
 			if len(matches) > 1 {
-				ipValue := matches[1]
-				if !strings.Contains(ipValue, ":") {
+				record := extractedRecord{ip: matches[1]}
+				if _, _, found := splitAddress(record.ip); !found {
 					// 尝试找端口
 					portRegex := regexp.MustCompile(`"port"\s*:\s*"?(\d{1,5})"?`)
-					portMatches := portRegex.FindStringSubmatch(processedLine)
-					if len(portMatches) > 1 {
-						ipValue = fmt.Sprintf("%s:%s", ipValue, portMatches[1])
+					if portMatches := portRegex.FindStringSubmatch(processedLine); len(portMatches) > 1 {
+						record.port = portMatches[1]
 					}
 				}
-				previousIPs = append(previousIPs, ipValue)
+				if address, ok := normalizeRecord(record); ok {
+					previousIPs = append(previousIPs, Candidate{Address: address})
+				}
 			}
-		} else {
-			// 检查是否为直接的IP:PORT格式
-			ipPortRegex := regexp.MustCompile(`^((?:\d{1,3}\.){3}\d{1,3}:\d{1,5})$`)
-			if ipPortRegex.MatchString(line) {
-				previousIPs = append(previousIPs, line)
+		} else if host, port, found := splitAddress(line); found {
+			// 直接的 IP:PORT、[IPv6]:PORT 或 域名:PORT 格式
+			if address, ok := normalizeAddress(host, port); ok {
+				previousIPs = append(previousIPs, Candidate{Address: address})
 			}
 		}
 	}
@@ -267,210 +460,55 @@ func LoadPreviousIPs() []string {
 	return previousIPs
 }
 
-// TestProxy 🔍 测试代理IP的可用性和类型
-//
-// 该函数接收IP地址列表，并通过多线程并发测试每个IP的:
-// - HTTP代理功能
-// - HTTPS代理功能
-// - SOCKS5代理功能
-// - 匿名性级别
-//
-// 参数:
-//   - ips: 需要测试的IP地址列表
+// findHistoryFile 🔍 查找历史IP文件, 依次尝试当前目录、上级目录和临时目录
 //
 // 返回值:
-//   - []string: 有效IP地址的JSON格式字符串列表
-func TestProxy(ips []string) []string {
-	logger := logger.GetLogger()
-
-	// 根据CPU核心数和待测试IP数量动态调整线程数
-	cpuCount := runtime.NumCPU()
-	// 线程数 = min(CPU核心数 * 8, IP数量, 200)
-	threadNum := cpuCount * 4
-	if threadNum > len(ips) {
-		threadNum = len(ips)
-	}
-	// 设置线程上限，避免资源耗尽
-	if threadNum > 80 {
-		threadNum = 80
-	}
-
-	logger.Info(fmt.Sprintf("🚀 使用 %d 个线程进行代理测试 (CPU核心: %d)", threadNum, cpuCount))
-
-	var wg sync.WaitGroup
-
-	// 定义IP信息结构体
-	type IpInfo struct {
-		IP        string `json:"ip"`
-		Http      bool   `json:"http"`
-		Https     bool   `json:"https"`
-		Socks5    bool   `json:"socks5"`
-		Anonymity string `json:"anonymity"`
-	}
-
-	// 使用并发安全的Map存储结果
-	var mutex sync.Mutex
-	IpList := make([]IpInfo, 0, len(ips)/3) // 预分配容量，假设约1/3的IP可用
-
-	// 使用并发安全的计数器追踪统计信息
-	var statsMutex sync.Mutex
-	validCount := 0
-	httpCount := 0
-	httpsCount := 0
-	socks5Count := 0
-
-	// 使用原子计数器跟踪进度
-	var processedCount int32
-	totalCount := len(ips)
-
-	// 对IP进行分批处理，避免一次性创建过多goroutine
-	const batchSize = 1000
-	batchCount := (totalCount + batchSize - 1) / batchSize // 向上取整计算批次数
-
-	logger.Info(fmt.Sprintf("📊 IP测试将分 %d 批进行，每批最多 %d 个", batchCount, batchSize))
-
-	// 定义检查函数 - 对每个IP进行功能性测试
-	checkFunc := func(ip string) {
-		defer wg.Done()
-
-		// 更新处理计数并定期输出进度
-		count := atomic.AddInt32(&processedCount, 1)
-		progress := float64(count) / float64(totalCount) * 100
-		// 减少进度日志频率，只在整数百分比变化时显示
-		if count == 1 || count%10 == 0 || count == int32(totalCount) {
-			logger.Info(fmt.Sprintf("🔄 代理测试进度: %d/%d (%.1f%%)", count, totalCount, progress))
-		}
-
-		// 快速检查 HTTP 代理功能，这是基本可用性检查
-		isHttp := check.FastCheckHttp(ip)
-		if !isHttp {
-			return
-		}
-
-		// HTTP检查通过，更新计数
-		statsMutex.Lock()
-		httpCount++
-		statsMutex.Unlock()
-
-		// 并行检查其他功能
-		var isHttps, isSocket5 bool
-		var anonymity string
-		var wg2 sync.WaitGroup
-		wg2.Add(3)
-
-		// 检查HTTPS
-		go func() {
-			defer wg2.Done()
-			isHttps = check.CheckHttpsResponse(ip, "", "")
-			if isHttps {
-				statsMutex.Lock()
-				httpsCount++
-				statsMutex.Unlock()
-			}
-		}()
-
-		// 检查SOCKS5
-		go func() {
-			defer wg2.Done()
-			isSocket5 = check.CheckSocket5Response(ip)
-			if isSocket5 {
-				statsMutex.Lock()
-				socks5Count++
-				statsMutex.Unlock()
-			}
-		}()
-
-		// 检查匿名性
-		go func() {
-			defer wg2.Done()
-			anonymity = check.CheckProxyAnonymity(ip)
-		}()
-
-		// 等待所有检查完成
-		wg2.Wait()
-
-		// 组装结果
-		ipInfo := IpInfo{
-			IP:        ip,
-			Http:      isHttp,
-			Https:     isHttps,
-			Socks5:    isSocket5,
-			Anonymity: anonymity,
-		}
-
-		// 使用互斥锁安全地添加到结果列表
-		mutex.Lock()
-		IpList = append(IpList, ipInfo)
-		validCount++
-		mutex.Unlock()
+//   - string: 第一个存在的文件路径, 都不存在时为空
+func findHistoryFile() string {
+	// 定义多个可能的文件路径
+	possiblePaths := []string{
+		"ip.txt",       // 当前目录
+		"../ip.txt",    // 父级目录
+		"../../ip.txt", // 父级的父级目录级目录
+		"/tmp/ip.txt",  // 临时目录
 	}
 
-	// 按批次处理IP
-	for batchIndex := 0; batchIndex < batchCount; batchIndex++ {
-		start := batchIndex * batchSize
-		end := start + batchSize
-		if end > totalCount {
-			end = totalCount
-		}
-
-		batchIps := ips[start:end]
-		logger.Info(fmt.Sprintf("🔄 开始处理第 %d/%d 批 (IP数量: %d)", batchIndex+1, batchCount, len(batchIps)))
-
-		// 创建批次的信号量来限制并发
-		sem := make(chan struct{}, threadNum)
-
-		// 为这一批次的每个IP启动一个goroutine
-		for _, ip := range batchIps {
-			wg.Add(1)
-
-			// 使用信号量控制并发
-			sem <- struct{}{}
-
-			go func(ipAddr string) {
-				defer func() { <-sem }() // 释放信号量
-				checkFunc(ipAddr)
-			}(ip)
+	for _, path := range possiblePaths {
+		if fileutil.IsExist(path) {
+			return path
 		}
-
-		// 等待当前批次处理完成
-		wg.Wait()
-		logger.Info(fmt.Sprintf("✅ 第 %d/%d 批处理完成", batchIndex+1, batchCount))
 	}
+	return ""
+}
 
-	// 使用更友好的完成信息
-	if validCount > 0 {
-		logger.Info(fmt.Sprintf("✅ 代理测试完成: 共测试 %d 个IP, 有效IP %d 个 (成功率: %.1f%%)",
-			totalCount, validCount, float64(validCount)/float64(totalCount)*100))
-		logger.Info(fmt.Sprintf("📊 代理类型统计: HTTP: %d, HTTPS: %d, SOCKS5: %d",
-			httpCount, httpsCount, socks5Count))
-	} else {
-		logger.Warn(fmt.Sprintf("⚠️ 代理测试完成: 共测试 %d 个IP, 未找到有效代理", totalCount))
-	}
-
-	// 转化数据类型，最终以字符串的切片传出
-	var validIPs []string
-
-	// 使用 lancet 的批量转换
-	for _, ipInfo := range IpList {
-		jsonStr, err := convertor.ToJson(ipInfo)
-		if err == nil {
-			validIPs = append(validIPs, jsonStr)
-		}
+// historyCandidate 🗂️ 从历史JSON记录恢复候选代理的来源与声明
+//
+// 参数:
+//   - address: 代理地址
+//   - ipInfo: 历史记录解析后的JSON对象
+//
+// 返回值:
+//   - Candidate: 候选代理
+func historyCandidate(address string, ipInfo map[string]interface{}) Candidate {
+	candidate := Candidate{Address: address}
+	candidate.Username, _ = ipInfo["username"].(string)
+	candidate.Password, _ = ipInfo["password"].(string)
+	if source, ok := ipInfo["source"].(string); ok {
+		candidate.Source = source
 	}
-
-	// 仅在总体转换有问题时记录一次错误
-	if len(validIPs) < len(IpList) {
-		logger.Warn(fmt.Sprintf("⚠️ 部分IP信息(%d/%d)转换失败", len(IpList)-len(validIPs), len(IpList)))
+	if claimed, ok := ipInfo["claimed"].(map[string]interface{}); ok {
+		protocol, _ := claimed["protocol"].(string)
+		country, _ := claimed["country"].(string)
+		anonymity, _ := claimed["anonymity"].(string)
+		candidate.Hints = newClaims(protocol, country, anonymity)
 	}
-
-	logger.Info(fmt.Sprintf("📋 最终获得 %d 个可用代理，准备输出", len(validIPs)))
-	return validIPs
+	return candidate
 }
 
 // ParseURLs 🔍 从HTML内容中提取IP地址和端口组合
 //
 // 该函数使用三种提取策略:
-// 1. 正则表达式匹配整个HTML中的IPv4:端口组合
+// 1. 正则表达式匹配整个HTML中的 IPv4:端口 与 [IPv6]:端口 组合(域名过于宽泛, 不在全文中匹配)
 // 2. 解析HTML表格结构，从表格单元格中提取IP和端口
 // 3. 从JSON格式数据中提取主机和端口信息
 //
@@ -478,17 +516,20 @@ func TestProxy(ips []string) []string {
 //   - html: 包含要解析的HTML内容的字符串
 //
 // 返回值：
-//   - []string: 格式为"IP:PORT"的字符串切片
-func ParseURLs(html string) []string {
+//   - []Candidate: 候选代理, 表格策略会同时读取协议、国家和匿名度列
+func ParseURLs(html string) []Candidate {
 	logger := logger.GetLogger()
-	var ips []string
-
-	// 策略1: 简单匹配整个HTML中的IPv4地址和端口号
-	pattern := `((?:\d{1,3}\.){3}\d{1,3}:\d{1,5})`
-	matchedGroups := strutil.RegexMatchAllGroups(pattern, html)
-	for _, ipSlice := range matchedGroups {
-		ips = append(ips, ipSlice...)
+	var ips []Candidate
+
+	// 策略1: 简单匹配整个HTML中的IPv4/IPv6地址和端口号
+	pattern := `(\b(?:\d{1,3}\.){3}\d{1,3}:\d{1,5}\b|\[[0-9A-Fa-f:.]+\]:\d{1,5}\b)`
+	var addresses []string
+	for _, ipSlice := range strutil.RegexMatchAllGroups(pattern, html) {
+		if address, ok := normalizeRecord(extractedRecord{ip: ipSlice[0]}); ok {
+			addresses = append(addresses, address)
+		}
 	}
+	ips = addressesToCandidates(addresses, "")
 
 	// 策略2: 从HTML表格结构中提取IP和端口
 	if len(ips) == 0 {
@@ -510,10 +551,10 @@ func ParseURLs(html string) []string {
 //   - html: HTML内容
 //
 // 返回值:
-//   - []string: 格式为"IP:PORT"的字符串切片
-func parseFromTable(html string) []string {
+//   - []Candidate: 候选代理, 表头可识别时附带协议、国家和匿名度声明
+func parseFromTable(html string) []Candidate {
 	logger := logger.GetLogger()
-	var ips []string
+	var ips []Candidate
 
 	// 使用goquery解析HTML文档
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
@@ -523,27 +564,28 @@ func parseFromTable(html string) []string {
 	}
 
 	// 查找所有表格行
+	columns := tableColumns{protocol: -1, https: -1, country: -1, anonymity: -1}
 	doc.Find("table tr").Each(func(index int, row *goquery.Selection) {
-		var ip, port string
+		var host, port string
+
+		// 表头行用于定位协议、国家和匿名度列
+		if headers := row.Find("th"); headers.Length() > 0 {
+			columns = detectTableColumns(headers)
+			return
+		}
 
 		// 遍历行中的所有单元格
-		row.Find("td").Each(func(i int, cell *goquery.Selection) {
+		cells := row.Find("td")
+		cells.Each(func(i int, cell *goquery.Selection) {
 			cellText := strings.TrimSpace(cell.Text())
 
-			// 精确匹配IPv4地址 (确保每个八位字节在0-255范围内)
-			if ip == "" {
-				ipPattern := `\b(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)(\.(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)){3}\b`
-				ipMatches := strutil.RegexMatchAllGroups(ipPattern, cellText)
-				if len(ipMatches) > 0 && len(ipMatches[0]) > 0 {
-					candidateIP := ipMatches[0][0]
-					// 使用lancet验证IP格式
-					if validator.IsIpV4(candidateIP) {
-						ip = candidateIP
-					}
-				}
+			// 先定位主机所在单元格, 单元格内自带的端口直接使用
+			if host == "" {
+				host, port = tableCellHost(cellText)
+				return
 			}
 
-			// 匹配端口号 (从文本中提取并验证范围)
+			// 匹配端口号 (只在主机之后的单元格中提取并验证范围, 避免取到序号列或IP中的数字)
 			if port == "" {
 				// 尝试提取端口号，不管是独立的还是嵌入在文本中的
 				portMatches := strutil.RegexMatchAllGroups(`\b([0-9]{1,5})\b`, cellText)
@@ -561,11 +603,13 @@ func parseFromTable(html string) []string {
 			}
 		})
 
-		// 如果在同一行找到了有效的IP和端口
-		if ip != "" && port != "" {
-			ipPort := fmt.Sprintf("%s:%s", ip, port)
+		// 如果在同一行找到了有效的主机和端口
+		if host == "" || port == "" {
+			return
+		}
+		if ipPort, ok := normalizeAddress(host, port); ok {
 			logger.Debug(fmt.Sprintf("✅ 从表格解析到代理: %s", ipPort))
-			ips = append(ips, ipPort)
+			ips = append(ips, Candidate{Address: ipPort, Hints: columns.claims(cells)})
 		}
 	})
 
@@ -573,24 +617,112 @@ func parseFromTable(html string) []string {
 	return ips
 }
 
+// tableIPv4Pattern 精确匹配单元格中的IPv4地址 (确保每个八位字节在0-255范围内) 及其后可能紧跟的端口
+var tableIPv4Pattern = regexp.MustCompile(`\b((?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)(?:\.(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)){3})\b(?::(\d{1,5})\b)?`)
+
+// tableCellHost 🔎 识别单元格中的代理主机
+//
+// 单元格中包含 IPv4 地址, 或整格内容为 IPv6 地址或域名时视为主机,
+// "ip:port"、"[v6]:port" 形式的单元格同时返回端口
+//
+// 参数:
+//   - cellText: 单元格文本
+//
+// 返回值:
+//   - string: 主机, 未识别时为空
+//   - string: 单元格内自带的端口, 没有时为空
+func tableCellHost(cellText string) (string, string) {
+	if matches := tableIPv4Pattern.FindStringSubmatch(cellText); matches != nil {
+		return matches[1], matches[2]
+	}
+
+	if host, port, ok := splitAddress(cellText); ok {
+		if _, valid := normalizeAddress(host, port); valid {
+			return host, port
+		}
+		return "", ""
+	}
+	if _, err := netip.ParseAddr(strings.Trim(cellText, "[]")); err == nil {
+		return strings.Trim(cellText, "[]"), ""
+	}
+	if isHostname(strings.ToLower(cellText)) {
+		return cellText, ""
+	}
+	return "", ""
+}
+
+// tableColumns 记录表头中各声明列的位置, -1 表示不存在
+type tableColumns struct {
+	protocol  int
+	https     int
+	country   int
+	anonymity int
+}
+
+// detectTableColumns 🧭 根据表头文本定位协议、国家和匿名度列
+//
+// 参数:
+//   - headers: 表头单元格
+//
+// 返回值:
+//   - tableColumns: 各列的位置
+func detectTableColumns(headers *goquery.Selection) tableColumns {
+	columns := tableColumns{protocol: -1, https: -1, country: -1, anonymity: -1}
+
+	headers.Each(func(i int, header *goquery.Selection) {
+		text := strings.ToLower(strings.TrimSpace(header.Text()))
+		switch {
+		case text == "https":
+			// free-proxy-list 等站点使用 yes/no 标记是否支持 HTTPS
+			columns.https = i
+		case strings.Contains(text, "protocol") || strings.Contains(text, "type") ||
+			strings.Contains(text, "协议") || strings.Contains(text, "类型"):
+			columns.protocol = i
+		case strings.Contains(text, "country") || strings.Contains(text, "location") ||
+			strings.Contains(text, "国家") || strings.Contains(text, "位置") || strings.Contains(text, "地区"):
+			columns.country = i
+		case strings.Contains(text, "anonymity") || strings.Contains(text, "匿名"):
+			columns.anonymity = i
+		}
+	})
+
+	return columns
+}
+
+// claims 读取数据行中声明列的内容, 未识别表头时返回空声明
+func (c tableColumns) claims(cells *goquery.Selection) Claims {
+	cellText := func(index int) string {
+		if index < 0 || index >= cells.Length() {
+			return ""
+		}
+		return strings.TrimSpace(cells.Eq(index).Text())
+	}
+
+	claims := newClaims(cellText(c.protocol), cellText(c.country), cellText(c.anonymity))
+	if claims.Protocol == "" && strings.EqualFold(cellText(c.https), "yes") {
+		claims.Protocol = "https"
+	}
+	return claims
+}
+
 // parseFromJson 📊 从JSON格式内容中提取IP和端口信息
 //
 // 参数:
 //   - html: 包含JSON数据的HTML内容
 //
 // 返回值:
-//   - []string: 格式为"IP:PORT"的字符串切片
-func parseFromJson(html string) []string {
+//   - []Candidate: 候选代理
+func parseFromJson(html string) []Candidate {
 	logger := logger.GetLogger()
-	var ips []string
+	var ips []Candidate
 
 	// 预处理HTML内容 - 处理可能存在的转义字符
 	processedHtml := strings.ReplaceAll(html, "\\\"", "\"")
 
 	// 尝试两种匹配模式：标准格式和转义格式
 	patterns := []string{
-		`"host"\s*:\s*"((?:\d{1,3}\.){3}\d{1,3})".*?"port"\s*:\s*(\d{1,5})`,
-		`host\s*:\s*"?((?:\d{1,3}\.){3}\d{1,3})"?.*?port\s*:\s*(\d{1,5})`,
+		`"host"\s*:\s*"([^"\s]+)".*?"port"\s*:\s*"?(\d{1,5})`,
+		`host\s*:\s*"?([0-9A-Za-z.:\[\]-]+?)"?\s*[,}].*?port\s*:\s*"?(\d{1,5})`,
 	}
 
 	var jsonMatches [][]string
@@ -617,17 +749,10 @@ func parseFromJson(html string) []string {
 	// 处理所有匹配结果
 	for _, match := range jsonMatches {
 		if len(match) > 2 {
-			ip := match[1]
-			port := match[2]
-
-			// 验证IP和端口的有效性
-			if validator.IsIpV4(ip) {
-				portNum, err := convertor.ToInt(port)
-				if err == nil && portNum > 0 && portNum <= 65535 {
-					ipPort := fmt.Sprintf("%s:%s", ip, port)
-					ips = append(ips, ipPort)
-					logger.Debug(fmt.Sprintf("✅ 从JSON解析到代理: %s", ipPort))
-				}
+			// 验证主机和端口的有效性, 主机可以是IPv4、IPv6或域名
+			if ipPort, ok := normalizeAddress(match[1], match[2]); ok {
+				ips = append(ips, Candidate{Address: ipPort})
+				logger.Debug(fmt.Sprintf("✅ 从JSON解析到代理: %s", ipPort))
 			}
 		}
 	}
@@ -635,25 +760,3 @@ func parseFromJson(html string) []string {
 	logger.Info(fmt.Sprintf("🔢 从JSON格式中总共提取到 %d 个IP地址", len(ips)))
 	return ips
 }
-
-// Output 💾 将有效IP写入文件
-//
-// 参数:
-//   - ips: 要写入文件的IP地址列表
-func Output(ips []string) {
-	filepath := "ip.txt"
-	logger := logger.GetLogger()
-
-	// 创建或清空文件
-	if !fileutil.CreateFile(filepath) {
-		panic("❌ 创建文件失败")
-	}
-	fileutil.ClearFile(filepath)
-
-	// 写入文件内容
-	for _, row := range ips {
-		fileutil.WriteStringToFile(filepath, row+"\n", true)
-	}
-
-	logger.Info(fmt.Sprintf("💾 成功写入 %d 个IP到文件 %s", len(ips), filepath))
-}
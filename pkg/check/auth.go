@@ -0,0 +1,101 @@
+// Author       :loyd
+// Date         :2025-03-30 20:10:26
+// LastEditors  :loyd
+// LastEditTime :2025-03-30 21:48:53
+// Description  :带认证信息的代理地址处理
+//
+
+package check
+
+import (
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ProxyAddress 🔑 组合代理地址与认证信息, 供本包的检查函数使用
+//
+// 参数:
+//   - address: 代理服务器地址(格式："ip:port"、"[v6]:port" 或 "host:port")
+//   - username: 用户名, 为空表示无需认证
+//   - password: 密码
+//
+// 返回值:
+//   - string: 无认证时为 "ip:port", 否则为 "user:pass@ip:port"(用户名和密码经过转义)
+func ProxyAddress(address, username, password string) string {
+	if username == "" {
+		return address
+	}
+	return url.UserPassword(username, password).String() + "@" + address
+}
+
+// splitProxyAuth 拆分 "user:pass@ip:port" 形式的地址, 返回拨号地址与认证信息
+func splitProxyAuth(ip string) (string, *url.Userinfo) {
+	at := strings.LastIndex(ip, "@")
+	if at < 0 {
+		return ip, nil
+	}
+
+	userinfo, address := ip[:at], ip[at+1:]
+	username, password, _ := strings.Cut(userinfo, ":")
+	if unescaped, err := url.PathUnescape(username); err == nil {
+		username = unescaped
+	}
+	if unescaped, err := url.PathUnescape(password); err == nil {
+		password = unescaped
+	}
+	return address, url.UserPassword(username, password)
+}
+
+// proxyURL 🔗 将检查函数接收的地址转换为 http 代理 URL
+//
+// 地址须能被 net.SplitHostPort 拆分, IPv6 地址须带方括号
+//
+// 参数:
+//   - ip: 代理服务器地址, 可带 "user:pass@" 前缀
+//
+// 返回值:
+//   - *url.URL: 代理 URL
+//   - error: 地址格式无效时返回错误
+func proxyURL(ip string) (*url.URL, error) {
+	address, auth := splitProxyAuth(ip)
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{Scheme: "http", User: auth, Host: net.JoinHostPort(host, port)}, nil
+}
+
+// basicAuthHeader 生成 Proxy-Authorization 使用的 Basic 认证值
+func basicAuthHeader(auth *url.Userinfo) string {
+	password, _ := auth.Password()
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth.Username()+":"+password))
+}
+
+// socks5Authenticate 按 RFC 1929 完成 SOCKS5 用户名/密码认证
+func socks5Authenticate(conn net.Conn, auth *url.Userinfo) error {
+	username := auth.Username()
+	password, _ := auth.Password()
+	if len(username) > 255 || len(password) > 255 {
+		return errors.New("socks5 credentials too long")
+	}
+
+	request := []byte{0x01, byte(len(username))}
+	request = append(request, username...)
+	request = append(request, byte(len(password)))
+	request = append(request, password...)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	response := make([]byte, 2)
+	if _, err := conn.Read(response); err != nil {
+		return err
+	}
+	if response[1] != 0x00 {
+		return errors.New("socks5 authentication rejected")
+	}
+	return nil
+}
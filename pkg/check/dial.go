@@ -0,0 +1,88 @@
+// Author       :loyd
+// Date         :2025-04-12 20:05:41
+// LastEditors  :loyd
+// LastEditTime :2025-04-12 21:18:36
+// Description  :拨号观察与本地故障识别, 用于按本机负载调整检查并发
+//
+
+package check
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// DialObserver 拨号观察函数, 每次检查项拨号到代理后调用
+//
+// 参数:
+//   - address: 拨号地址
+//   - err: 拨号错误, 成功时为 nil
+type DialObserver func(address string, err error)
+
+// IsLocalError 🩺 判断拨号错误是否可能源自本机而不是代理
+//
+// 本机资源耗尽(见 IsResourceExhausted)以及连接超时都计入: 并发过高时本机来不及完成握手,
+// 表现为大量超时; 代理本身不可达同样会超时, 调用方需要结合基线区分
+//
+// 参数:
+//   - err: 拨号错误
+//
+// 返回值:
+//   - bool: 是否为本机资源耗尽或连接超时
+func IsLocalError(err error) bool {
+	return IsResourceExhausted(err) || IsDialTimeout(err)
+}
+
+// IsResourceExhausted 判断拨号错误是否为本机端口耗尽、文件句柄或缓冲区不足, 这类错误一定源自本机
+func IsResourceExhausted(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, syscall.EADDRNOTAVAIL) ||
+		errors.Is(err, syscall.EADDRINUSE) ||
+		errors.Is(err, syscall.EMFILE) ||
+		errors.Is(err, syscall.ENFILE) ||
+		errors.Is(err, syscall.ENOBUFS)
+}
+
+// IsDialTimeout 判断拨号错误是否为连接超时, 包括拨号超时与内核返回的 ETIMEDOUT
+func IsDialTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ETIMEDOUT) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// dial 建立到代理的TCP连接并通知拨号观察函数
+func (c Checker) dial(ctx context.Context, address string, timeout time.Duration) (net.Conn, error) {
+	conn, err := dialContext(ctx, address, timeout)
+	c.observe(address, err)
+	return conn, err
+}
+
+// dialer 返回通知拨号观察函数的 http.Transport 拨号函数
+func (c Checker) dialer(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if c.OnDial == nil {
+		return dialer.DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, address)
+		c.observe(address, err)
+		return conn, err
+	}
+}
+
+// observe 通知拨号观察函数, ctx 取消导致的失败不通知
+func (c Checker) observe(address string, err error) {
+	if c.OnDial == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	c.OnDial(address, err)
+}
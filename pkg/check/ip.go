@@ -8,11 +8,11 @@
 package check
 
 import (
+	"context"
 	"crypto/tls"
 	"io"
 	"net"
 	"net/http"
-	"net/url"
 	"regexp"
 	"strings"
 	"time"
@@ -21,29 +21,50 @@ import (
 	"github.com/duke-git/lancet/v2/netutil"
 )
 
+// originPattern 提取 httpbin 响应中的 origin 字段
+var originPattern = regexp.MustCompile(`"origin"\s*:\s*"([^"]*)"`)
+
+// Checker 代理检查器, 零值使用各检查项的默认超时
+type Checker struct {
+	// Timeout 单个检查项(连接、握手与读取)的超时, 0 表示使用各检查项的默认值
+	Timeout time.Duration
+	// OnDial 每次拨号到代理后调用, 为空时不观察
+	OnDial DialObserver
+}
+
+// timeout 返回检查项使用的超时, 未配置时使用该检查项的默认值
+func (c Checker) timeout(fallback time.Duration) time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return fallback
+}
+
 // FastCheckHttp 🚀 快速验证HTTP代理基本可用性
 //
 // 这是一个轻量级验证函数，仅进行基本的连接性测试，超时更短
 // 用于快速筛选可能有效的代理，减少后续详细测试的数量
 //
 // 参数:
-//   - ip: 代理服务器地址(格式："ip:port")
+//   - ctx: 取消时立即中断检查
+//   - ip: 代理服务器地址(格式："ip:port"、"[v6]:port"、"host:port", 可带 "user:pass@" 前缀)
 //
 // 返回值:
 //   - bool: 代理是否能基本连通
-func FastCheckHttp(ip string) bool {
-	// 配置极短的超时时间
-	timeout := 3 * time.Second
+func (c Checker) FastCheckHttp(ctx context.Context, ip string) bool {
+	// 配置极短的超时时间, 默认 3 秒
+	timeout := c.timeout(3 * time.Second)
 
 	// 快速检查TCP连接是否可建立 - 这是最基本的可用性检查
-	conn, err := net.DialTimeout("tcp", ip, timeout)
+	address, _ := splitProxyAuth(ip)
+	conn, err := c.dial(ctx, address, timeout)
 	if err != nil {
 		return false
 	}
 	conn.Close()
 
 	// 解析代理URL
-	proxyUrl, err := url.Parse("http://" + ip)
+	proxyUrl, err := proxyURL(ip)
 	if err != nil {
 		return false
 	}
@@ -55,10 +76,7 @@ func FastCheckHttp(ip string) bool {
 			// 禁用HTTP/2以减少握手开销
 			TLSNextProto: make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
 			// 设置更激进的超时
-			DialContext: (&net.Dialer{
-				Timeout:   timeout,
-				KeepAlive: timeout,
-			}).DialContext,
+			DialContext:           c.dialer(&net.Dialer{Timeout: timeout, KeepAlive: timeout}),
 			TLSHandshakeTimeout:   timeout,
 			ResponseHeaderTimeout: timeout,
 			ExpectContinueTimeout: 1 * time.Second,
@@ -69,7 +87,7 @@ func FastCheckHttp(ip string) bool {
 	}
 
 	// 请求简单的HEAD而非完整GET
-	req, err := http.NewRequest("HEAD", "http://www.baidu.com", nil)
+	req, err := http.NewRequestWithContext(ctx, "HEAD", "http://www.baidu.com", nil)
 	if err != nil {
 		return false
 	}
@@ -93,20 +111,21 @@ func FastCheckHttp(ip string) bool {
 // 通过代理向指定网站发送HTTP请求并验证响应
 //
 // 参数:
-//   - ip: 代理服务器地址(格式："ip:port")
+//   - ctx: 取消时立即中断检查
+//   - ip: 代理服务器地址(格式："ip:port"、"[v6]:port"、"host:port", 可带 "user:pass@" 前缀)
 //   - reqDomain: 可选的测试目标域名，默认使用百度
 //   - strContains: 可选的响应内容验证字符串
 //
 // 返回值:
 //   - bool: 代理是否能成功完成HTTP请求
-func CheckHttpResponse(ip, reqDomain, strContains string) bool {
+func (c Checker) CheckHttpResponse(ctx context.Context, ip, reqDomain, strContains string) bool {
 	logger := logger.GetLogger()
 	maxRetries := 1 // 减少重试次数
 	var lastErr error
 
-	for i := 0; i <= maxRetries; i++ {
+	for i := 0; i <= maxRetries && ctx.Err() == nil; i++ {
 		// 解析代理URL
-		proxyUrl, err := url.Parse("http://" + ip)
+		proxyUrl, err := proxyURL(ip)
 		if err != nil {
 			if i == maxRetries {
 				logger.Debugf("❌ 解析代理URL错误 [%s]: %v", ip, err)
@@ -138,11 +157,15 @@ func CheckHttpResponse(ip, reqDomain, strContains string) bool {
 				InsecureSkipVerify: true,
 			},
 			Proxy:   proxyUrl,
-			Timeout: 5 * time.Second, // 减少超时时间
+			Timeout: c.timeout(5 * time.Second), // 减少超时时间
 		}
 
 		// 发送请求并获取响应
 		client := netutil.NewHttpClientWithConfig(&clientCfg)
+		client.Context = ctx
+		if transport, ok := client.Client.Transport.(*http.Transport); ok {
+			transport.DialContext = c.dialer(&net.Dialer{Timeout: clientCfg.Timeout})
+		}
 		resp, err := client.SendRequest(&req)
 		if err != nil {
 			lastErr = err
@@ -173,18 +196,20 @@ func CheckHttpResponse(ip, reqDomain, strContains string) bool {
 // CheckHttpsResponse 🔒 验证代理的HTTPS代理功能
 //
 // 参数:
-//   - ip: 代理服务器地址(格式："ip:port")
+//   - ctx: 取消时立即中断检查
+//   - ip: 代理服务器地址(格式："ip:port"、"[v6]:port"、"host:port", 可带 "user:pass@" 前缀)
 //   - reqDomain: 可选的测试目标域名，默认使用百度
 //   - strContains: 可选的响应内容验证字符串
 //
 // 返回值:
 //   - bool: 代理是否支持HTTPS连接
-func CheckHttpsResponse(ip, reqDomain, strContains string) bool {
-	// 使用更短的超时时间
-	timeout := 4 * time.Second
+func (c Checker) CheckHttpsResponse(ctx context.Context, ip, reqDomain, strContains string) bool {
+	// 使用更短的超时时间, 默认 4 秒
+	timeout := c.timeout(4 * time.Second)
 
 	// 建立到代理服务器的TCP连接
-	tcpConn, err := net.DialTimeout("tcp", ip, timeout)
+	address, auth := splitProxyAuth(ip)
+	tcpConn, err := c.dial(ctx, address, timeout)
 	if err != nil {
 		return false
 	}
@@ -196,26 +221,29 @@ func CheckHttpsResponse(ip, reqDomain, strContains string) bool {
 
 	// 解析用户提供的目标
 	if reqDomain != "" {
-		domainParts := strings.Split(reqDomain, ":")
-		targetDomain = domainParts[0]
-		if len(domainParts) > 1 {
-			targetPort = domainParts[1]
+		targetDomain = reqDomain
+		if host, port, err := net.SplitHostPort(reqDomain); err == nil {
+			targetDomain, targetPort = host, port
 		}
 	}
 
 	// 规范化域名格式
-	if !strings.HasPrefix(targetDomain, "www.") && !strings.Contains(targetDomain, ".") {
+	if !strings.HasPrefix(targetDomain, "www.") && !strings.Contains(targetDomain, ".") && net.ParseIP(targetDomain) == nil {
 		targetDomain = "www." + targetDomain
 	}
 
 	// 构建完整目标地址
-	targetAddress := targetDomain + ":" + targetPort
+	targetAddress := net.JoinHostPort(targetDomain, targetPort)
 
 	// 构建简化的CONNECT请求
 	connectReq := "CONNECT " + targetAddress + " HTTP/1.1\r\n" +
 		"Host: " + targetAddress + "\r\n" +
 		"User-Agent: Mozilla/5.0\r\n" +
-		"Connection: keep-alive\r\n\r\n"
+		"Connection: keep-alive\r\n"
+	if auth != nil {
+		connectReq += "Proxy-Authorization: " + basicAuthHeader(auth) + "\r\n"
+	}
+	connectReq += "\r\n"
 
 	// 设置写入超时
 	tcpConn.SetWriteDeadline(time.Now().Add(timeout))
@@ -240,16 +268,18 @@ func CheckHttpsResponse(ip, reqDomain, strContains string) bool {
 // CheckSocket5Response 🧦 验证代理的SOCKS5代理功能
 //
 // 参数:
-//   - ip: 代理服务器地址(格式："ip:port")
+//   - ctx: 取消时立即中断检查
+//   - ip: 代理服务器地址(格式："ip:port"、"[v6]:port"、"host:port", 可带 "user:pass@" 前缀)
 //
 // 返回值:
 //   - bool: 代理是否支持SOCKS5协议
-func CheckSocket5Response(ip string) bool {
-	// 减少超时时间
-	timeout := 4 * time.Second
+func (c Checker) CheckSocket5Response(ctx context.Context, ip string) bool {
+	// 减少超时时间, 默认 4 秒
+	timeout := c.timeout(4 * time.Second)
 
 	// 建立TCP连接
-	destConn, err := net.DialTimeout("tcp", ip, timeout)
+	address, auth := splitProxyAuth(ip)
+	destConn, err := c.dial(ctx, address, timeout)
 	if err != nil {
 		return false
 	}
@@ -263,6 +293,10 @@ func CheckSocket5Response(ip string) bool {
 	// 0x01: 支持1种认证方法
 	// 0x00: 无需认证的方法
 	req := []byte{0x05, 0x01, 0x00}
+	if auth != nil {
+		// 0x02: 同时支持用户名/密码认证
+		req = []byte{0x05, 0x02, 0x00, 0x02}
+	}
 	_, err = destConn.Write(req)
 	if err != nil {
 		return false
@@ -277,24 +311,49 @@ func CheckSocket5Response(ip string) bool {
 	}
 
 	// 验证服务器响应
-	return bytes[0] == 0x05 && bytes[1] != 0xFF
+	if bytes[0] != 0x05 || bytes[1] == 0xFF {
+		return false
+	}
+
+	// 服务器选择了用户名/密码认证
+	if bytes[1] == 0x02 {
+		return auth != nil && socks5Authenticate(destConn, auth) == nil
+	}
+	return true
 }
 
 // CheckProxyAnonymity 🎭 检测代理的匿名性级别
 //
 // 参数:
-//   - ip: 代理服务器地址(格式："ip:port")
+//   - ctx: 取消时立即中断检查
+//   - ip: 代理服务器地址(格式："ip:port"、"[v6]:port"、"host:port", 可带 "user:pass@" 前缀)
 //
 // 返回值:
 //   - string: 代理的匿名性级别
-func CheckProxyAnonymity(ip string) string {
-	// 减少超时时间
-	timeout := 5 * time.Second
+func (c Checker) CheckProxyAnonymity(ctx context.Context, ip string) string {
+	anonymity, _ := c.CheckProxyExit(ctx, ip)
+	return anonymity
+}
+
+// CheckProxyExit 🚪 检测代理的匿名性级别与出口IP
+//
+// 出口IP取自 httpbin 返回的 origin 字段中最后一个地址, 即实际连接到 httpbin 的地址
+//
+// 参数:
+//   - ctx: 取消时立即中断检查
+//   - ip: 代理服务器地址(格式："ip:port"、"[v6]:port"、"host:port", 可带 "user:pass@" 前缀)
+//
+// 返回值:
+//   - string: 代理的匿名性级别, 检测失败时为空
+//   - string: 代理的出口IP, 无法识别时为空
+func (c Checker) CheckProxyExit(ctx context.Context, ip string) (string, string) {
+	// 减少超时时间, 默认 5 秒
+	timeout := c.timeout(5 * time.Second)
 
 	// 解析代理URL
-	proxyUrl, err := url.Parse("http://" + ip)
+	proxyUrl, err := proxyURL(ip)
 	if err != nil {
-		return ""
+		return "", ""
 	}
 
 	// 配置HTTP客户端
@@ -303,20 +362,21 @@ func CheckProxyAnonymity(ip string) string {
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 			Proxy:           http.ProxyURL(proxyUrl),
+			DialContext:     c.dialer(&net.Dialer{Timeout: timeout}),
 		},
 	}
 
 	// 创建请求
-	request, err := http.NewRequest("GET", "http://httpbin.org/get", nil)
+	request, err := http.NewRequestWithContext(ctx, "GET", "http://httpbin.org/get", nil)
 	if err != nil {
-		return ""
+		return "", ""
 	}
 	request.Header.Add("Proxy-Connection", "keep-alive")
 
 	// 发送请求
 	res, err := client.Do(request)
 	if err != nil {
-		return ""
+		return "", ""
 	}
 	defer res.Body.Close()
 
@@ -326,19 +386,60 @@ func CheckProxyAnonymity(ip string) string {
 
 	// 快速检查响应是否有效
 	if !strings.Contains(result, `"url"`) {
-		return ""
+		return "", ""
+	}
+
+	// origin 可能是 "客户端IP, 代理IP" 形式, 最后一个为出口IP
+	exitIP := ""
+	if matches := originPattern.FindStringSubmatch(result); matches != nil {
+		origins := strings.Split(matches[1], ",")
+		exitIP = strings.TrimSpace(origins[len(origins)-1])
+		if net.ParseIP(exitIP) == nil {
+			exitIP = ""
+		}
 	}
 
 	// 使用预编译的正则表达式检查IP泄露
 	ipRegex := regexp.MustCompile(`(\d+?\.\d+?\.\d+?\.\d+?,.+\d+?\.\d+?\.\d+?\.\d+?)`)
 	if ipRegex.FindString(result) != "" {
-		return "transparent"
+		return "transparent", exitIP
 	}
 
 	// 检查是否泄露了请求头
 	if strings.Contains(result, "keep-alive") {
-		return "common"
+		return "common", exitIP
 	}
 
-	return "high"
+	return "high", exitIP
+}
+
+// dialContext 在超时内建立TCP连接, ctx 取消时关闭连接以中断后续读写
+//
+// 参数:
+//   - ctx: 控制拨号与连接生命周期的上下文
+//   - address: 拨号地址
+//   - timeout: 拨号超时
+//
+// 返回值:
+//   - net.Conn: 连接, 关闭连接时同时停止监听 ctx
+//   - error: 拨号失败或 ctx 已取消时返回错误
+func dialContext(ctx context.Context, address string, timeout time.Duration) (net.Conn, error) {
+	conn, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	return &watchedConn{Conn: conn, stop: stop}, nil
+}
+
+// watchedConn 关闭时停止监听 ctx 的连接
+type watchedConn struct {
+	net.Conn
+	stop func() bool
+}
+
+// Close 停止监听 ctx 并关闭连接
+func (c *watchedConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
 }
@@ -0,0 +1,180 @@
+// Author       :loyd
+// Date         :2025-04-03 20:12:05
+// LastEditors  :loyd
+// LastEditTime :2025-04-03 22:40:18
+// Description  :离线 MaxMind 格式数据库(mmdb)查询
+//
+
+package geo
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Reader 离线 mmdb 数据库读取器, 可被多个 goroutine 并发使用
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+// ASNRecord 自治系统信息, 字段与 GeoLite2-ASN 数据库一致
+type ASNRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// LocationRecord 国家与城市信息, 兼容 GeoLite2 Country 与 City 数据库
+type LocationRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Info 单个IP的地理位置与自治系统信息
+type Info struct {
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+}
+
+// IsZero 判断是否未查询到任何信息
+func (i Info) IsZero() bool {
+	return i == Info{}
+}
+
+// Locator 组合国家/城市与 ASN 数据库的查询器, 任一数据库都可以缺省
+type Locator struct {
+	location *Reader
+	asn      *Reader
+}
+
+// Open 📖 打开 mmdb 数据库文件
+//
+// 参数:
+//   - path: 数据库文件路径
+//
+// 返回值:
+//   - *Reader: 数据库读取器
+//   - error: 文件不存在或格式无效时返回错误
+func Open(path string) (*Reader, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open mmdb %s: %w", path, err)
+	}
+	return &Reader{db: db}, nil
+}
+
+// ASN 🛰️ 查询IP所属的自治系统
+//
+// 参数:
+//   - addr: 待查询的IP
+//
+// 返回值:
+//   - ASNRecord: 自治系统信息, 数据库中不存在时为零值
+//   - error: 查询失败时返回错误
+func (r *Reader) ASN(addr netip.Addr) (ASNRecord, error) {
+	var record ASNRecord
+	err := r.db.Lookup(net.IP(addr.Unmap().AsSlice()), &record)
+	return record, err
+}
+
+// Close 关闭数据库文件
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
+
+// Location 📍 查询IP所在的国家与城市
+//
+// 参数:
+//   - addr: 待查询的IP
+//
+// 返回值:
+//   - LocationRecord: 国家与城市信息, 数据库中不存在时为零值
+//   - error: 查询失败时返回错误
+func (r *Reader) Location(addr netip.Addr) (LocationRecord, error) {
+	var record LocationRecord
+	err := r.db.Lookup(net.IP(addr.Unmap().AsSlice()), &record)
+	return record, err
+}
+
+// NewLocator 🗺️ 打开国家/城市与 ASN 数据库, 路径为空的数据库会被跳过
+//
+// 参数:
+//   - locationPath: GeoLite2 Country 或 City 数据库路径
+//   - asnPath: GeoLite2 ASN 数据库路径
+//
+// 返回值:
+//   - *Locator: 查询器, 两个路径都为空时返回 nil
+//   - error: 数据库无法打开时返回错误
+func NewLocator(locationPath, asnPath string) (*Locator, error) {
+	if locationPath == "" && asnPath == "" {
+		return nil, nil
+	}
+
+	locator := &Locator{}
+	if locationPath != "" {
+		reader, err := Open(locationPath)
+		if err != nil {
+			return nil, err
+		}
+		locator.location = reader
+	}
+	if asnPath != "" {
+		reader, err := Open(asnPath)
+		if err != nil {
+			locator.Close()
+			return nil, err
+		}
+		locator.asn = reader
+	}
+	return locator, nil
+}
+
+// Lookup 🔍 查询IP的国家、城市、ASN 与组织, 查询失败的部分留空
+//
+// 参数:
+//   - addr: 待查询的IP
+//
+// 返回值:
+//   - Info: 查询结果
+func (l *Locator) Lookup(addr netip.Addr) Info {
+	var info Info
+	if l.location != nil {
+		if record, err := l.location.Location(addr); err == nil {
+			info.Country = record.Country.ISOCode
+			info.City = record.City.Names["en"]
+		}
+	}
+	if l.asn != nil {
+		if record, err := l.asn.ASN(addr); err == nil {
+			info.ASN = record.Number
+			info.Org = record.Organization
+		}
+	}
+	return info
+}
+
+// ASNReader 返回 ASN 数据库读取器, 供名单过滤等共用, 未配置 ASN 数据库时为 nil
+func (l *Locator) ASNReader() *Reader {
+	if l == nil {
+		return nil
+	}
+	return l.asn
+}
+
+// Close 关闭已打开的数据库
+func (l *Locator) Close() {
+	if l.location != nil {
+		l.location.Close()
+	}
+	if l.asn != nil {
+		l.asn.Close()
+	}
+}
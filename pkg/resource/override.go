@@ -0,0 +1,285 @@
+// Author       :loyd
+// Date         :2025-03-12 21:08:16
+// LastEditors  :loyd
+// LastEditTime :2025-03-12 22:41:03
+// Description  :配置文件路径解析与环境变量/命令行覆盖
+
+package resource
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/duke-git/lancet/v2/strutil"
+)
+
+const (
+	// EnvConfigPath 指定配置文件路径的环境变量
+	EnvConfigPath = "PROXIES_CONFIG"
+	// EnvPrefix 配置项覆盖环境变量的前缀, 例如 PROXIES_POOL_PORT
+	EnvPrefix = "PROXIES"
+)
+
+// overrideField 描述一个可被覆盖的配置项
+type overrideField struct {
+	section string
+	key     string
+	value   reflect.Value
+}
+
+// ResolveConfigPath 🧭 按优先级解析配置文件路径
+//
+// 优先级: 命令行 --config > 环境变量 PROXIES_CONFIG > 默认位置
+//
+// 参数:
+//   - cliPath: 命令行指定的路径, 为空表示未指定
+//
+// 返回值:
+//   - string: 配置文件绝对路径
+//   - error: 文件不存在或无法解析时返回错误
+func ResolveConfigPath(cliPath string) (string, error) {
+	for _, candidate := range []string{cliPath, os.Getenv(EnvConfigPath)} {
+		if strutil.IsBlank(candidate) {
+			continue
+		}
+		if _, err := os.Stat(candidate); err != nil {
+			return "", fmt.Errorf("config file %s: %w", candidate, err)
+		}
+		return absPath(candidate)
+	}
+
+	return DefaultConfigPath()
+}
+
+// LoadWithOverrides 📦 加载配置并依次应用环境变量和命令行覆盖
+//
+// 最终生效的优先级(由低到高): 配置文件 < 环境变量 < 命令行 --set,
+// 合并后的配置会经过 Validate 校验
+//
+// 参数:
+//   - cliPath: 命令行指定的配置文件路径
+//   - sets: 命令行覆盖项, 格式为 "section.key=value"
+//
+// 返回值:
+//   - *Config: 合并后的配置
+//   - error: 加载或覆盖失败时返回错误
+func LoadWithOverrides(cliPath string, sets []string) (*Config, error) {
+	path, err := ResolveConfigPath(cliPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ApplyEnvOverrides(config); err != nil {
+		return nil, err
+	}
+	if err := ApplyCLIOverrides(config, sets); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ApplyEnvOverrides 🌱 使用环境变量覆盖配置项
+//
+// 环境变量名由前缀、段名和键名组成, 驼峰键名会转为下划线形式,
+// 例如 pool.verifyTime 对应 PROXIES_POOL_VERIFY_TIME
+//
+// 参数:
+//   - config: 需要被覆盖的配置
+//
+// 返回值:
+//   - error: 环境变量的值无法转换为目标类型时返回错误
+func ApplyEnvOverrides(config *Config) error {
+	for _, field := range overrideFields(config) {
+		name := EnvName(field.section, field.key)
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFieldValue(field.value, raw); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// ApplyCLIOverrides ⌨️ 使用命令行 --set 参数覆盖配置项
+//
+// 参数:
+//   - config: 需要被覆盖的配置
+//   - sets: 覆盖项列表, 格式为 "section.key=value", 键名不区分大小写
+//
+// 返回值:
+//   - error: 格式错误、键不存在或值无法转换时返回错误
+func ApplyCLIOverrides(config *Config, sets []string) error {
+	fields := overrideFields(config)
+
+	for _, set := range sets {
+		name, raw, found := strings.Cut(set, "=")
+		if !found {
+			return fmt.Errorf("invalid override %q, expected section.key=value", set)
+		}
+		section, key, found := strings.Cut(strings.TrimSpace(name), ".")
+		if !found {
+			return fmt.Errorf("invalid override key %q, expected section.key", name)
+		}
+
+		matched := false
+		for _, field := range fields {
+			if strings.EqualFold(field.section, section) && strings.EqualFold(field.key, key) {
+				if err := setFieldValue(field.value, strings.TrimSpace(raw)); err != nil {
+					return fmt.Errorf("invalid value for %s: %w", name, err)
+				}
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("unknown config key %q", name)
+		}
+	}
+
+	return nil
+}
+
+// EnvName 🏷️ 返回配置项对应的环境变量名
+//
+// 参数:
+//   - section: 配置段名, 例如 pool
+//   - key: 配置键名, 例如 verifyTime
+//
+// 返回值:
+//   - string: 环境变量名, 例如 PROXIES_POOL_VERIFY_TIME
+func EnvName(section, key string) string {
+	return strings.Join([]string{EnvPrefix, envSegment(section), envSegment(key)}, "_")
+}
+
+// OverrideKeys 📋 列出全部可覆盖的配置键, 格式为 "section.key"
+//
+// 返回值:
+//   - []string: 可覆盖的配置键列表
+func OverrideKeys() []string {
+	var keys []string
+	for _, field := range overrideFields(&Config{}) {
+		keys = append(keys, field.section+"."+field.key)
+	}
+	return keys
+}
+
+// overrideFields 遍历配置中所有段的标量字段, 数组表(如 platform)不参与覆盖
+func overrideFields(config *Config) []overrideField {
+	var fields []overrideField
+
+	root := reflect.ValueOf(config).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		sectionValue := root.Field(i)
+		if sectionValue.Kind() != reflect.Struct {
+			continue
+		}
+		section := tomlName(root.Type().Field(i))
+
+		for j := 0; j < sectionValue.NumField(); j++ {
+			fieldType := sectionValue.Type().Field(j)
+			if !fieldType.IsExported() || !isOverridable(fieldType.Type) {
+				continue
+			}
+			fields = append(fields, overrideField{
+				section: section,
+				key:     tomlName(fieldType),
+				value:   sectionValue.Field(j),
+			})
+		}
+	}
+
+	return fields
+}
+
+// isOverridable 判断字段类型是否支持从字符串覆盖
+func isOverridable(fieldType reflect.Type) bool {
+	switch fieldType.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		elemKind := fieldType.Elem().Kind()
+		return elemKind == reflect.String || elemKind == reflect.Int
+	}
+	return false
+}
+
+// setFieldValue 将字符串转换为字段类型并赋值, 切片使用逗号分隔
+func setFieldValue(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(value)
+	case reflect.Int, reflect.Int64:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(value)
+	case reflect.Float64:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(value)
+	case reflect.Slice:
+		items := strutil.SplitAndTrim(raw, ",")
+		slice := reflect.MakeSlice(field.Type(), 0, len(items))
+		for _, item := range items {
+			if item == "" {
+				continue
+			}
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := setFieldValue(elem, item); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		field.Set(slice)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// tomlName 读取字段的 toml 标签名, 缺省时使用字段名
+func tomlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// envSegment 将驼峰形式的名称转换为大写下划线形式
+func envSegment(name string) string {
+	var builder strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 && !unicode.IsUpper(runes[i-1]) {
+			builder.WriteRune('_')
+		}
+		builder.WriteRune(unicode.ToUpper(r))
+	}
+	return builder.String()
+}
@@ -7,53 +7,345 @@
 package resource
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 )
 
 // Config 定义顶层配置结构
 type Config struct {
-	Pool      PoolConfig       `toml:"pool"`
-	Platforms []PlatformConfig `toml:"platform"`
+	Include   []string         `toml:"include" yaml:"include" json:"include"`
+	Pool      PoolConfig       `toml:"pool" yaml:"pool" json:"pool"`
+	Fetch     FetchConfig      `toml:"fetch" yaml:"fetch" json:"fetch"`
+	Check     CheckConfig      `toml:"check" yaml:"check" json:"check"`
+	Cache     CacheConfig      `toml:"cache" yaml:"cache" json:"cache"`
+	Fixture   FixtureConfig    `toml:"fixture" yaml:"fixture" json:"fixture"`
+	Filter    FilterConfig     `toml:"filter" yaml:"filter" json:"filter"`
+	Geo       GeoConfig        `toml:"geo" yaml:"geo" json:"geo"`
+	Network   NetworkConfig    `toml:"network" yaml:"network" json:"network"`
+	Output    OutputConfig     `toml:"output" yaml:"output" json:"output"`
+	Platforms []PlatformConfig `toml:"platform" yaml:"platform" json:"platform"`
+
+	// Files 记录本次加载涉及的全部配置文件, 供热加载监听变化
+	Files []string `toml:"-" yaml:"-" json:"-"`
 }
 
 // PoolConfig 定义池配置
 type PoolConfig struct {
-	Port       int    `toml:"port"`
-	Cron       string `toml:"cron"`
-	VerifyTime int    `toml:"verifyTime"`
-	Debug      bool   `toml:"debug"`
+	Port       int    `toml:"port" yaml:"port" json:"port"`
+	Cron       string `toml:"cron" yaml:"cron" json:"cron"`
+	VerifyTime int    `toml:"verifyTime" yaml:"verifyTime" json:"verifyTime"`
+	Debug      bool   `toml:"debug" yaml:"debug" json:"debug"`
+	// Interval 长驻模式下两轮爬取之间的间隔(秒), 0 表示使用默认值(30 分钟)
+	Interval int `toml:"interval" yaml:"interval" json:"interval"`
+	// Deadline 每轮爬取(抓取与检查)的总时限(秒), 到期后不再检查新的代理并写入已验证的结果, 0 表示不限制
+	Deadline int `toml:"deadline" yaml:"deadline" json:"deadline"`
+}
+
+// FetchConfig 定义代理源页面的并发抓取策略, 0 表示使用默认值
+type FetchConfig struct {
+	// Workers 同时处理的URL组数量, 同组(同一模板的页码)内按顺序请求
+	Workers int `toml:"workers" yaml:"workers" json:"workers"`
+	// PerHost 同一主机的最大并发请求数
+	PerHost int `toml:"perHost" yaml:"perHost" json:"perHost"`
+	// HostDelay 同一主机两次请求之间的最小间隔(毫秒)
+	HostDelay int `toml:"hostDelay" yaml:"hostDelay" json:"hostDelay"`
+	// Deadline 整体抓取时限(秒), 到期后使用已收集到的结果继续, 0 表示不限制
+	Deadline int `toml:"deadline" yaml:"deadline" json:"deadline"`
+	// Retries 平台未配置 retries 时的默认重试次数, -1 表示不重试
+	Retries int `toml:"retries" yaml:"retries" json:"retries"`
+	// Report 每轮抓取报告(各URL的结果与错误分类)的 JSON 输出路径, 为空时只输出日志汇总
+	Report string `toml:"report" yaml:"report" json:"report"`
+}
+
+// CheckConfig 定义代理检查的并发与超时, 0 表示使用默认值
+type CheckConfig struct {
+	// Workers 同时检查的代理数量, 开启 adaptive 时为并发上限
+	Workers int `toml:"workers" yaml:"workers" json:"workers"`
+	// Adaptive 按本地失败率自动调整并发: 失败率低时逐步增加, 升高时减半
+	Adaptive bool `toml:"adaptive" yaml:"adaptive" json:"adaptive"`
+	// MinWorkers 自动调整时的并发下限
+	MinWorkers int `toml:"minWorkers" yaml:"minWorkers" json:"minWorkers"`
+	// ControlProxies 已知可用的对照地址(host:port), 定期拨号, 失败视为本地故障
+	ControlProxies []string `toml:"controlProxies" yaml:"controlProxies" json:"controlProxies"`
+	// ProbeTimeout 单个检查项(HTTP、HTTPS、SOCKS5、匿名度)的超时(毫秒), 0 表示使用各检查项的默认值(3~5 秒)
+	ProbeTimeout int `toml:"probeTimeout" yaml:"probeTimeout" json:"probeTimeout"`
+	// Budget 单个代理全部检查项的总时限(毫秒), 0 表示不限制
+	Budget int `toml:"budget" yaml:"budget" json:"budget"`
+	// QueueSize 等待检查的候选代理缓冲数量, 队列满时抓取随之放缓
+	QueueSize int `toml:"queueSize" yaml:"queueSize" json:"queueSize"`
+}
+
+// CacheConfig 定义代理源响应的缓存, 配合 ETag/Last-Modified 发送条件请求
+type CacheConfig struct {
+	// Path 缓存文件路径, 为空时不缓存
+	Path string `toml:"path" yaml:"path" json:"path"`
+	// MaxAge 缓存的最长有效期(秒), 超过后重新完整下载, 0 表示 24 小时
+	MaxAge int `toml:"maxAge" yaml:"maxAge" json:"maxAge"`
+}
+
+// FixtureConfig 定义代理源响应的录制与回放, 用于离线复现解析问题
+type FixtureConfig struct {
+	// Mode 为 record 时把每个来源的原始响应保存到 Dir, 为 replay 时从 Dir 读取响应而不访问网络, 为空时关闭
+	Mode string `toml:"mode" yaml:"mode" json:"mode"`
+	// Dir 响应文件目录, 默认 fixtures
+	Dir string `toml:"dir" yaml:"dir" json:"dir"`
+}
+
+// FilterConfig 定义代理地址的允许/拒绝名单
+//
+// 拒绝名单优先于允许名单, 允许名单为空表示不限制
+type FilterConfig struct {
+	// AllowCIDRs 只保留落在这些网段内的代理, 单个IP视为 /32 或 /128
+	AllowCIDRs []string `toml:"allowCidrs" yaml:"allowCidrs" json:"allowCidrs"`
+	// DenyCIDRs 丢弃落在这些网段内的代理
+	DenyCIDRs []string `toml:"denyCidrs" yaml:"denyCidrs" json:"denyCidrs"`
+	// AllowPorts 只保留使用这些端口的代理
+	AllowPorts []int `toml:"allowPorts" yaml:"allowPorts" json:"allowPorts"`
+	// DenyPorts 丢弃使用这些端口的代理
+	DenyPorts []int `toml:"denyPorts" yaml:"denyPorts" json:"denyPorts"`
+	// AllowASNs 只保留属于这些自治系统的代理, 需要配置 geo.asnDatabase
+	AllowASNs []int `toml:"allowAsns" yaml:"allowAsns" json:"allowAsns"`
+	// DenyASNs 丢弃属于这些自治系统的代理, 需要配置 geo.asnDatabase
+	DenyASNs []int `toml:"denyAsns" yaml:"denyAsns" json:"denyAsns"`
+	// ASNDatabase 已废弃, ASN 数据库统一使用 geo.asnDatabase, 设置时校验失败
+	ASNDatabase string `toml:"asnDatabase" yaml:"asnDatabase" json:"asnDatabase"`
+}
+
+// GeoConfig 定义离线地理位置数据库, 均为可选
+type GeoConfig struct {
+	// Database GeoLite2 Country 或 City 数据库路径, 提供国家(及城市)
+	Database string `toml:"database" yaml:"database" json:"database"`
+	// ASNDatabase GeoLite2 ASN 数据库路径, 提供 ASN 与所属组织
+	ASNDatabase string `toml:"asnDatabase" yaml:"asnDatabase" json:"asnDatabase"`
+}
+
+// NetworkConfig 定义代理网络类型(datacenter/residential/mobile)的判断规则
+//
+// 依据 geo.asnDatabase 提供的 ASN 与组织名称, 以及开启 reverseDns 后的反向解析结果,
+// 规则列表为空时使用内置的常见云厂商与运营商特征
+type NetworkConfig struct {
+	// DatacenterASNs 托管/云服务商的 ASN
+	DatacenterASNs []int `toml:"datacenterAsns" yaml:"datacenterAsns" json:"datacenterAsns"`
+	// MobileASNs 移动运营商的 ASN
+	MobileASNs []int `toml:"mobileAsns" yaml:"mobileAsns" json:"mobileAsns"`
+	// DatacenterPatterns 匹配反向解析域名或组织名称的正则, 命中视为机房IP
+	DatacenterPatterns []string `toml:"datacenterPatterns" yaml:"datacenterPatterns" json:"datacenterPatterns"`
+	// MobilePatterns 命中视为移动网络的正则
+	MobilePatterns []string `toml:"mobilePatterns" yaml:"mobilePatterns" json:"mobilePatterns"`
+	// ResidentialPatterns 命中视为家庭宽带的正则
+	ResidentialPatterns []string `toml:"residentialPatterns" yaml:"residentialPatterns" json:"residentialPatterns"`
+	// ReverseDNS 是否对出口IP做反向解析
+	ReverseDNS bool `toml:"reverseDns" yaml:"reverseDns" json:"reverseDns"`
+}
+
+// OutputConfig 定义导出到 ip.txt 的代理需要满足的条件
+type OutputConfig struct {
+	// Countries 只导出位于这些国家的代理(ISO 3166 两位代码), 优先按出口IP判断, 需要配置 geo.database
+	Countries []string `toml:"countries" yaml:"countries" json:"countries"`
+	// NetworkTypes 只导出这些网络类型的代理: datacenter、residential、mobile、unknown
+	NetworkTypes []string `toml:"networkTypes" yaml:"networkTypes" json:"networkTypes"`
 }
 
 // PlatformConfig 定义代理平台配置
 type PlatformConfig struct {
-	Name   string   `toml:"name"`
-	Method string   `toml:"method"`
-	URLs   []string `toml:"urls"`
-	Proxy  bool     `toml:"proxy"`
+	Name   string   `toml:"name" yaml:"name" json:"name"`
+	Method string   `toml:"method" yaml:"method" json:"method"`
+	URLs   []string `toml:"urls" yaml:"urls" json:"urls"`
+	// Proxy 被反爬页面拦截时通过上一轮验证通过的代理中转重试
+	Proxy bool `toml:"proxy" yaml:"proxy" json:"proxy"`
+
+	// URL 地址模板, 支持 {page} 及 vars 中声明的占位符
+	URL string `toml:"url" yaml:"url" json:"url"`
+	// Pages 模板页码范围, 例如 "1-10" 或 "1,3,5-7"
+	Pages string `toml:"pages" yaml:"pages" json:"pages"`
+	// Vars 模板变量, 多个变量按笛卡尔积展开, 例如 { stype = [1, 3] }
+	Vars map[string][]any `toml:"vars" yaml:"vars" json:"vars"`
+	// StopOnEmpty 某页未解析到代理时跳过同组后续页码
+	StopOnEmpty bool `toml:"stopOnEmpty" yaml:"stopOnEmpty" json:"stopOnEmpty"`
+
+	// Headers 自定义请求头, 未设置 User-Agent 和 Referer 时使用浏览器默认值
+	Headers map[string]string `toml:"headers" yaml:"headers" json:"headers"`
+	// Cookies 随请求发送的 Cookie
+	Cookies map[string]string `toml:"cookies" yaml:"cookies" json:"cookies"`
+	// Body 请求体, 用于 POST 类型的接口
+	Body string `toml:"body" yaml:"body" json:"body"`
+	// Timeout 单次请求超时时间(秒), 0 表示使用默认值
+	Timeout int `toml:"timeout" yaml:"timeout" json:"timeout"`
+	// Retries 请求失败后的重试次数, 0 表示不重试, 未设置时使用 fetch.retries
+	Retries *int `toml:"retries" yaml:"retries" json:"retries"`
+
+	// Format 内容格式: auto(默认)、html、text、csv、base64、clash, gzip/zip 压缩内容会自动解压
+	Format string `toml:"format" yaml:"format" json:"format"`
+	// Charset 页面字符集, 如 "gbk", 为空时根据响应头和 meta 标签自动识别
+	Charset string `toml:"charset" yaml:"charset" json:"charset"`
+	// Decode 按顺序启用的反混淆解码器, 如 ["base64", "document-write"]
+	Decode []string `toml:"decode" yaml:"decode" json:"decode"`
+	// Protocol 该平台全部代理的声明协议, 未设置时尝试读取URL中的 protocol 参数
+	Protocol string `toml:"protocol" yaml:"protocol" json:"protocol"`
+	// Extractor 声明式提取规则, 未设置时使用内置的启发式解析
+	Extractor *ExtractorConfig `toml:"extractor" yaml:"extractor" json:"extractor"`
+
+	// File 记录平台定义所在的配置文件, 用于错误提示
+	File string `toml:"-" yaml:"-" json:"-"`
+}
+
+// ExtractorConfig 定义平台的声明式提取规则
+//
+// type = "css":   row 为行选择器, ip/port 等为相对行的选择器, 可用 "选择器@属性" 读取属性值
+// type = "regex": pattern 为包含 ip、port、protocol、country、anonymity 命名分组的正则表达式
+// type = "json":  path 为记录所在的路径(如 "data.list[*]"), ip/port 等为相对记录的路径
+type ExtractorConfig struct {
+	Type      string `toml:"type" yaml:"type" json:"type"`
+	Row       string `toml:"row" yaml:"row" json:"row"`
+	Pattern   string `toml:"pattern" yaml:"pattern" json:"pattern"`
+	Path      string `toml:"path" yaml:"path" json:"path"`
+	IP        string `toml:"ip" yaml:"ip" json:"ip"`
+	Port      string `toml:"port" yaml:"port" json:"port"`
+	Protocol  string `toml:"protocol" yaml:"protocol" json:"protocol"`
+	Country   string `toml:"country" yaml:"country" json:"country"`
+	Anonymity string `toml:"anonymity" yaml:"anonymity" json:"anonymity"`
 }
 
 // LoadConfig 从指定路径加载配置文件
+//
+// 支持 .toml、.yaml/.yml 和 .json 格式, 并递归展开 include 指令:
+// include 中的路径相对于当前文件所在目录, 支持通配符, 被包含文件中仅
+// [[platform]] 与 include 生效, 所有平台按加载顺序合并并检测重复;
+// 同一文件被多处包含时只合并一次, 通配符匹配不包含当前文件自身
 func LoadConfig(configPath string) (*Config, error) {
+	visited := make(map[string]bool)
+
+	config, err := loadConfigFile(configPath, visited, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkDuplicatePlatforms(config.Platforms); err != nil {
+		return nil, err
+	}
+
+	for file := range visited {
+		config.Files = append(config.Files, file)
+	}
+	sort.Strings(config.Files)
+
+	return config, nil
+}
+
+// loadConfigFile 加载单个配置文件并递归合并其包含的文件
+//
+// visited 记录已经加载过的文件, 再次包含时跳过; active 记录当前的包含链, 再次进入时视为循环包含
+func loadConfigFile(configPath string, visited, active map[string]bool) (*Config, error) {
+	path, err := absPath(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if active[path] {
+		return nil, fmt.Errorf("config include cycle detected at %s", path)
+	}
+	visited[path] = true
+	active[path] = true
+	defer delete(active, path)
+
+	config, err := decodeConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for i := range config.Platforms {
+		config.Platforms[i].File = path
+	}
+
+	// 按声明顺序展开 include, 同一模式内按文件名排序
+	for _, pattern := range config.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q in %s: %w", pattern, path, err)
+		}
+		sort.Strings(matches)
+		isGlob := strings.ContainsAny(pattern, "*?[")
+
+		for _, match := range matches {
+			match, err := absPath(match)
+			if err != nil {
+				return nil, err
+			}
+			// 通配符匹配到自身时跳过, 已合并过的文件不再重复合并, 仍在包含链中的文件交给下一层报告循环
+			if isGlob && match == path {
+				continue
+			}
+			if visited[match] && !active[match] {
+				continue
+			}
+			included, err := loadConfigFile(match, visited, active)
+			if err != nil {
+				return nil, err
+			}
+			config.Platforms = append(config.Platforms, included.Platforms...)
+		}
+	}
+
+	return config, nil
+}
+
+// decodeConfigFile 根据扩展名选择解码器读取配置文件
+func decodeConfigFile(path string) (*Config, error) {
 	var config Config
 
 	// 读取配置文件
-	data, err := os.ReadFile(configPath)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	err = toml.Unmarshal(data, &config)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &config)
+	case ".json":
+		err = json.Unmarshal(data, &config)
+	default:
+		err = toml.Unmarshal(data, &config)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode config file: %w", err)
+		return nil, fmt.Errorf("failed to decode config file %s: %w", path, err)
 	}
 
 	return &config, nil
 }
 
+// checkDuplicatePlatforms 检测重名平台以及被多个平台重复声明的 URL
+func checkDuplicatePlatforms(platforms []PlatformConfig) error {
+	names := make(map[string]string)
+	urls := make(map[string]string)
+
+	for _, platform := range platforms {
+		if file, ok := names[platform.Name]; ok {
+			return fmt.Errorf("duplicate platform %q defined in %s and %s", platform.Name, file, platform.File)
+		}
+		names[platform.Name] = platform.File
+
+		// 模板错误由 Validate 报告, 这里只检查能够展开的地址
+		expanded, _ := platform.ExpandURLs()
+		for _, url := range expanded {
+			if owner, ok := urls[url]; ok {
+				return fmt.Errorf("duplicate url %s in platforms %q and %q", url, owner, platform.Name)
+			}
+			urls[url] = platform.Name
+		}
+	}
+
+	return nil
+}
+
 // DefaultConfigPath 返回默认配置文件路径
 func DefaultConfigPath() (string, error) {
 	// 尝试找到配置文件的常见位置
@@ -64,13 +356,18 @@ func DefaultConfigPath() (string, error) {
 
 	for _, loc := range locations {
 		if _, err := os.Stat(loc); err == nil {
-			absPath, err := filepath.Abs(loc)
-			if err != nil {
-				return "", err
-			}
-			return absPath, nil
+			return absPath(loc)
 		}
 	}
 
 	return "", fmt.Errorf("configuration file not found in known locations")
 }
+
+// absPath 将路径转换为绝对路径
+func absPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return abs, nil
+}
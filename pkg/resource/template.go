@@ -0,0 +1,180 @@
+// Author       :loyd
+// Date         :2025-03-16 19:42:05
+// LastEditors  :loyd
+// LastEditTime :2025-03-16 20:37:51
+// Description  :代理源 URL 模板展开
+
+package resource
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/duke-git/lancet/v2/strutil"
+)
+
+// pagePlaceholder 模板中表示页码的占位符名称
+const pagePlaceholder = "page"
+
+// maxPages 单个页码范围最多展开的页数, 避免误写的范围展开出海量请求
+const maxPages = 1000
+
+// placeholderPattern 匹配模板中形如 {name} 的占位符
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// URLGroups 🧩 展开平台的全部请求地址并按页序分组
+//
+// urls 中的每个地址单独成组; url 模板按 vars 的笛卡尔积展开,
+// 同一组合下的各页按 pages 顺序组成一组, 便于 stopOnEmpty 在空页时提前结束
+//
+// 返回值:
+//   - [][]string: 分组后的请求地址
+//   - error: 页码范围或模板变量无效时返回错误
+func (p PlatformConfig) URLGroups() ([][]string, error) {
+	var groups [][]string
+	for _, url := range p.URLs {
+		groups = append(groups, []string{url})
+	}
+
+	if strutil.IsBlank(p.URL) {
+		return groups, nil
+	}
+
+	pages, err := ParsePageRange(p.Pages)
+	if err != nil {
+		return nil, fmt.Errorf("platform %s: %w", p.Name, err)
+	}
+
+	for _, combination := range p.varCombinations() {
+		var group []string
+		if len(pages) == 0 {
+			url, err := expandTemplate(p.URL, combination)
+			if err != nil {
+				return nil, fmt.Errorf("platform %s: %w", p.Name, err)
+			}
+			group = append(group, url)
+		}
+		for _, page := range pages {
+			combination[pagePlaceholder] = strconv.Itoa(page)
+			url, err := expandTemplate(p.URL, combination)
+			if err != nil {
+				return nil, fmt.Errorf("platform %s: %w", p.Name, err)
+			}
+			group = append(group, url)
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// ExpandURLs 📜 返回平台展开后的全部请求地址
+//
+// 返回值:
+//   - []string: 请求地址列表
+//   - error: 模板展开失败时返回错误
+func (p PlatformConfig) ExpandURLs() ([]string, error) {
+	groups, err := p.URLGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, group := range groups {
+		urls = append(urls, group...)
+	}
+	return urls, nil
+}
+
+// ParsePageRange 🔢 解析页码范围
+//
+// 支持单页、闭区间及其逗号组合, 例如 "1-10"、"1,3,5-7"
+//
+// 参数:
+//   - spec: 页码范围描述, 为空时返回空列表
+//
+// 返回值:
+//   - []int: 按声明顺序展开的页码
+//   - error: 格式错误或页数超过 maxPages 时返回错误
+func ParsePageRange(spec string) ([]int, error) {
+	var pages []int
+
+	for _, part := range strutil.SplitAndTrim(spec, ",") {
+		if part == "" {
+			continue
+		}
+
+		startText, endText, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(startText))
+		if err != nil {
+			return nil, fmt.Errorf("invalid page range %q", spec)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(endText))
+			if err != nil {
+				return nil, fmt.Errorf("invalid page range %q", spec)
+			}
+		}
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("invalid page range %q", spec)
+		}
+		if end-start+1 > maxPages-len(pages) {
+			return nil, fmt.Errorf("page range %q exceeds %d pages", spec, maxPages)
+		}
+
+		for page := start; page <= end; page++ {
+			pages = append(pages, page)
+		}
+	}
+
+	return pages, nil
+}
+
+// varCombinations 计算模板变量的笛卡尔积, 变量名按字母序展开以保证顺序稳定
+func (p PlatformConfig) varCombinations() []map[string]string {
+	names := make([]string, 0, len(p.Vars))
+	for name := range p.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	combinations := []map[string]string{{}}
+	for _, name := range names {
+		var next []map[string]string
+		for _, combination := range combinations {
+			for _, value := range p.Vars[name] {
+				expanded := make(map[string]string, len(combination)+1)
+				for key, val := range combination {
+					expanded[key] = val
+				}
+				expanded[name] = fmt.Sprint(value)
+				next = append(next, expanded)
+			}
+		}
+		combinations = next
+	}
+
+	return combinations
+}
+
+// expandTemplate 替换模板中的占位符, 存在未定义的占位符时返回错误
+func expandTemplate(template string, values map[string]string) (string, error) {
+	var missing []string
+	url := placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		missing = append(missing, name)
+		return placeholder
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined template variables %v in %s", missing, template)
+	}
+	return url, nil
+}
@@ -0,0 +1,263 @@
+// Author       :loyd
+// Date         :2025-03-14 20:16:37
+// LastEditors  :loyd
+// LastEditTime :2025-03-14 21:02:55
+// Description  :配置校验与差异比较
+
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/duke-git/lancet/v2/slice"
+	"github.com/duke-git/lancet/v2/strutil"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// validMethods 代理源允许使用的请求方法
+var validMethods = []string{"GET", "POST"}
+
+// validNetworkTypes 导出条件允许使用的网络类型
+var validNetworkTypes = []string{"datacenter", "residential", "mobile", "unknown"}
+
+// validFixtureModes 来源响应录制/回放允许使用的模式
+var validFixtureModes = []string{"record", "replay"}
+
+// validFormats 代理源允许声明的内容格式
+var validFormats = []string{"", "auto", "html", "text", "csv", "base64", "clash"}
+
+// DecoderNames 平台 decode 中可以使用的反混淆解码器名称, 与 internal 中注册的解码器一一对应
+var DecoderNames = []string{"xor", "base64", "hex", "document-write", "port-class-map", "hidden-elements"}
+
+// Validate ✅ 校验配置是否可用
+//
+// 返回值:
+//   - error: 所有校验失败项合并后的错误, 配置有效时为 nil
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Pool.Port < 0 || c.Pool.Port > 65535 {
+		errs = append(errs, fmt.Errorf("pool.port %d out of range", c.Pool.Port))
+	}
+	if c.Pool.VerifyTime < 0 {
+		errs = append(errs, fmt.Errorf("pool.verifyTime must not be negative"))
+	}
+	if c.Pool.Interval < 0 {
+		errs = append(errs, fmt.Errorf("pool.interval must not be negative"))
+	}
+	if c.Pool.Deadline < 0 {
+		errs = append(errs, fmt.Errorf("pool.deadline must not be negative"))
+	}
+
+	if c.Fetch.Workers < 0 || c.Fetch.PerHost < 0 || c.Fetch.HostDelay < 0 || c.Fetch.Deadline < 0 || c.Fetch.Retries < -1 {
+		errs = append(errs, errors.New("fetch: workers, perHost, hostDelay and deadline must not be negative, retries must be -1 or greater"))
+	}
+	if c.Check.Workers < 0 || c.Check.ProbeTimeout < 0 || c.Check.Budget < 0 || c.Check.QueueSize < 0 {
+		errs = append(errs, errors.New("check: workers, probeTimeout, budget and queueSize must not be negative"))
+	}
+	if c.Check.MinWorkers < 0 || (c.Check.Workers > 0 && c.Check.MinWorkers > c.Check.Workers) {
+		errs = append(errs, fmt.Errorf("check.minWorkers must be between 0 and workers (%d)", c.Check.Workers))
+	}
+	for _, address := range c.Check.ControlProxies {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			errs = append(errs, fmt.Errorf("check: invalid control proxy %q", address))
+		}
+	}
+	if c.Cache.MaxAge < 0 {
+		errs = append(errs, errors.New("cache.maxAge must not be negative"))
+	}
+	if c.Fixture.Mode != "" && !slice.Contain(validFixtureModes, strings.ToLower(c.Fixture.Mode)) {
+		errs = append(errs, fmt.Errorf("fixture: unsupported mode %q", c.Fixture.Mode))
+	}
+	if err := c.Filter.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if (len(c.Filter.AllowASNs) > 0 || len(c.Filter.DenyASNs) > 0) && strutil.IsBlank(c.Geo.ASNDatabase) {
+		errs = append(errs, errors.New("filter: allowAsns and denyAsns require geo.asnDatabase"))
+	}
+	if len(c.Output.Countries) > 0 && strutil.IsBlank(c.Geo.Database) {
+		errs = append(errs, errors.New("output.countries requires geo.database"))
+	}
+	for _, networkType := range c.Output.NetworkTypes {
+		if !slice.Contain(validNetworkTypes, strings.ToLower(networkType)) {
+			errs = append(errs, fmt.Errorf("output: unsupported network type %q", networkType))
+		}
+	}
+	if len(c.Output.NetworkTypes) > 0 && strutil.IsBlank(c.Geo.ASNDatabase) && !c.Network.ReverseDNS {
+		errs = append(errs, errors.New("output.networkTypes requires geo.asnDatabase or network.reverseDns"))
+	}
+	for _, pattern := range append(append(append([]string{}, c.Network.DatacenterPatterns...), c.Network.MobilePatterns...), c.Network.ResidentialPatterns...) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("network: invalid pattern %q: %w", pattern, err))
+		}
+	}
+
+	for i, platform := range c.Platforms {
+		label := platform.Name
+		if strutil.IsBlank(label) {
+			label = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Errorf("platform %s: name is required", label))
+		}
+		if !slice.Contain(validMethods, strings.ToUpper(platform.Method)) {
+			errs = append(errs, fmt.Errorf("platform %s: unsupported method %q", label, platform.Method))
+		}
+		if !slice.Contain(validFormats, strings.ToLower(platform.Format)) {
+			errs = append(errs, fmt.Errorf("platform %s: unsupported format %q", label, platform.Format))
+		}
+		for _, name := range platform.Decode {
+			if !slice.Contain(DecoderNames, name) {
+				errs = append(errs, fmt.Errorf("platform %s: unknown decoder %q", label, name))
+			}
+		}
+		if platform.Charset != "" {
+			if _, err := htmlindex.Get(platform.Charset); err != nil {
+				errs = append(errs, fmt.Errorf("platform %s: unsupported charset %q", label, platform.Charset))
+			}
+		}
+		if len(platform.URLs) == 0 && strutil.IsBlank(platform.URL) {
+			errs = append(errs, fmt.Errorf("platform %s: urls or url template is required", label))
+		}
+		for name, values := range platform.Vars {
+			if len(values) == 0 {
+				errs = append(errs, fmt.Errorf("platform %s: vars.%s must not be empty", label, name))
+			}
+		}
+		if _, err := platform.URLGroups(); err != nil {
+			errs = append(errs, err)
+		}
+		if platform.Timeout < 0 || (platform.Retries != nil && *platform.Retries < 0) {
+			errs = append(errs, fmt.Errorf("platform %s: timeout and retries must not be negative", label))
+		}
+		if platform.Extractor != nil {
+			if err := platform.Extractor.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("platform %s: %w", label, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate ✅ 校验允许/拒绝名单中的网段、端口和 ASN
+//
+// 返回值:
+//   - error: 所有校验失败项合并后的错误, 配置有效时为 nil
+func (f *FilterConfig) Validate() error {
+	var errs []error
+
+	for _, cidr := range append(append([]string{}, f.AllowCIDRs...), f.DenyCIDRs...) {
+		if _, err := ParsePrefix(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("filter: invalid cidr %q", cidr))
+		}
+	}
+	for _, port := range append(append([]int{}, f.AllowPorts...), f.DenyPorts...) {
+		if port <= 0 || port > 65535 {
+			errs = append(errs, fmt.Errorf("filter: port %d out of range", port))
+		}
+	}
+	if !strutil.IsBlank(f.ASNDatabase) {
+		errs = append(errs, errors.New("filter.asnDatabase is no longer supported, set geo.asnDatabase instead"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ParsePrefix 🧮 解析 CIDR 网段, 不带掩码的单个IP视为只包含自身的网段
+//
+// 参数:
+//   - cidr: 网段文本, 如 "10.0.0.0/8"、"2001:db8::/32" 或 "1.2.3.4"
+//
+// 返回值:
+//   - netip.Prefix: 已掩码的网段
+//   - error: 格式无效时返回错误
+func ParsePrefix(cidr string) (netip.Prefix, error) {
+	cidr = strings.TrimSpace(cidr)
+	if !strings.Contains(cidr, "/") {
+		addr, err := netip.ParseAddr(cidr)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+// Validate ✅ 校验提取规则是否完整
+//
+// 返回值:
+//   - error: 规则类型未知或缺少必要字段时返回错误
+func (e *ExtractorConfig) Validate() error {
+	switch e.Type {
+	case "css":
+		if strutil.IsBlank(e.Row) || strutil.IsBlank(e.IP) {
+			return errors.New("css extractor requires row and ip selectors")
+		}
+	case "regex":
+		pattern, err := regexp.Compile(e.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid extractor pattern: %w", err)
+		}
+		if pattern.SubexpIndex("ip") < 0 {
+			return errors.New("regex extractor requires a named group (?P<ip>...)")
+		}
+	case "json":
+		if strutil.IsBlank(e.IP) {
+			return errors.New("json extractor requires an ip path")
+		}
+	default:
+		return fmt.Errorf("unknown extractor type %q", e.Type)
+	}
+	return nil
+}
+
+// DiffPlatforms 🔀 比较两份配置中的平台差异
+//
+// 参数:
+//   - previous: 变更前的配置
+//   - current: 变更后的配置
+//
+// 返回值:
+//   - added: 新增的平台名称
+//   - removed: 移除的平台名称
+//   - changed: 定义发生变化的平台名称
+func DiffPlatforms(previous, current *Config) (added, removed, changed []string) {
+	before := make(map[string]PlatformConfig)
+	for _, platform := range previous.Platforms {
+		before[platform.Name] = platform
+	}
+
+	after := make(map[string]bool)
+	for _, platform := range current.Platforms {
+		after[platform.Name] = true
+
+		old, ok := before[platform.Name]
+		if !ok {
+			added = append(added, platform.Name)
+			continue
+		}
+		old.File, platform.File = "", ""
+		if !reflect.DeepEqual(old, platform) {
+			changed = append(changed, platform.Name)
+		}
+	}
+
+	for _, platform := range previous.Platforms {
+		if !after[platform.Name] {
+			removed = append(removed, platform.Name)
+		}
+	}
+
+	return added, removed, changed
+}
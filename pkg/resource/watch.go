@@ -0,0 +1,147 @@
+// Author       :loyd
+// Date         :2025-03-14 21:10:42
+// LastEditors  :loyd
+// LastEditTime :2025-03-14 22:27:18
+// Description  :长驻模式下的配置热加载
+
+package resource
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"zol9527/proxies/pkg/logger"
+)
+
+// Watcher 监听配置文件变化并原子地替换当前生效的配置
+type Watcher struct {
+	cliPath   string
+	overrides []string
+	interval  time.Duration
+
+	current  atomic.Pointer[Config]
+	mutex    sync.Mutex
+	modTimes map[string]time.Time
+}
+
+// NewWatcher 🔭 加载初始配置并创建配置监听器
+//
+// 参数:
+//   - cliPath: 命令行指定的配置文件路径
+//   - overrides: 命令行覆盖项, 每次重新加载时都会重新应用
+//   - interval: 轮询文件修改时间的间隔
+//
+// 返回值:
+//   - *Watcher: 配置监听器
+//   - error: 初始配置加载或校验失败时返回错误
+func NewWatcher(cliPath string, overrides []string, interval time.Duration) (*Watcher, error) {
+	config, err := LoadWithOverrides(cliPath, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher := &Watcher{
+		cliPath:   cliPath,
+		overrides: overrides,
+		interval:  interval,
+	}
+	watcher.current.Store(config)
+	watcher.modTimes = statFiles(config.Files)
+
+	return watcher, nil
+}
+
+// Current 📄 返回当前生效的配置, 调用方不应修改返回值
+func (w *Watcher) Current() *Config {
+	return w.current.Load()
+}
+
+// Run 🔁 轮询配置文件并响应 SIGHUP 信号重新加载配置, 直到 ctx 结束
+//
+// 轮询只能发现已加载文件的修改, 新增的 include 文件需要发送 SIGHUP 触发加载
+//
+// 参数:
+//   - ctx: 控制监听生命周期的上下文
+func (w *Watcher) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			logger.GetLogger().Info("📡 收到 SIGHUP, 重新加载配置")
+			w.Reload()
+		case <-ticker.C:
+			if w.changed() {
+				logger.GetLogger().Info("📝 检测到配置文件变化, 重新加载配置")
+				w.Reload()
+			}
+		}
+	}
+}
+
+// Reload ♻️ 重新加载并校验配置, 失败时保留旧配置
+//
+// 返回值:
+//   - error: 新配置加载或校验失败时返回错误
+func (w *Watcher) Reload() error {
+	log := logger.GetLogger()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	config, err := LoadWithOverrides(w.cliPath, w.overrides)
+	if err != nil {
+		log.Error(fmt.Sprintf("❌ 配置重新加载失败, 继续使用旧配置: %v", err))
+		// 记录当前修改时间, 避免在文件再次修改前重复报错
+		w.modTimes = statFiles(w.current.Load().Files)
+		return err
+	}
+
+	previous := w.current.Swap(config)
+	w.modTimes = statFiles(config.Files)
+
+	added, removed, changed := DiffPlatforms(previous, config)
+	log.Info(fmt.Sprintf("✅ 配置已重新加载: 新增平台 [%s], 移除平台 [%s], 变更平台 [%s]",
+		strings.Join(added, ", "), strings.Join(removed, ", "), strings.Join(changed, ", ")))
+	return nil
+}
+
+// changed 判断被监听的配置文件是否有新增、删除或修改
+func (w *Watcher) changed() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	current := statFiles(w.current.Load().Files)
+	if len(current) != len(w.modTimes) {
+		return true
+	}
+	for file, modTime := range current {
+		if !modTime.Equal(w.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// statFiles 读取一组文件的修改时间, 不存在的文件会被忽略
+func statFiles(files []string) map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+	return modTimes
+}